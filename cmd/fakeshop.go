@@ -1,53 +1,207 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
 	"github.com/jsfan/fake-shop/internal/config"
 	"github.com/jsfan/fake-shop/internal/graph"
-	"github.com/jsfan/fake-shop/internal/graph/generated"
 	"github.com/jsfan/fake-shop/internal/store"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const defaultPort = "8888"
 const stockFile = "config/stock.yaml"
 const promotionsFile = "config/promotions.yaml"
+const defaultCartTTL = 600 * time.Second
+const defaultReapInterval = 30 * time.Second
+const defaultExpiryWarning = 60 * time.Second
+const shutdownTimeout = 10 * time.Second
+const keepAliveInterval = 10 * time.Second
+const defaultReloadInterval = 5 * time.Second
+
+// openDatabase opens a shop with its state kept in a database file
+func openDatabase(dbFile string) (*store.Shop, *store.BoltDB, error) {
+	db, err := store.OpenBolt(dbFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	promotionRepo, err := db.Promotions()
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	shop, err := store.NewShop(db.Inventory(), promotionRepo, db.Carts(), db.Orders(), store.SystemClock)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	return shop, db, nil
+}
+
+// newServer sets up the GraphQL server with a websocket transport for subscriptions
+func newServer(es graphql.ExecutableSchema) *handler.Server {
+	srv := handler.New(es)
+	srv.AddTransport(transport.Websocket{
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true // frontends under development are served from other origins
+			},
+		},
+		KeepAlivePingInterval: keepAliveInterval,
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+	srv.SetQueryCache(lru.New(1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New(100),
+	})
+	return srv
+}
+
+// superviseReaper runs the cart reaper and restarts it should it ever panic
+func superviseReaper(ctx context.Context, shop *store.Shop, interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+	for ctx.Err() == nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					glog.Errorf("Cart reaper crashed, restarting: %+v", r)
+				}
+			}()
+			shop.RunCartReaper(ctx, interval)
+		}()
+	}
+}
+
+// validate checks the stock and promotions files and reports every problem found. It returns the exit code.
+func validate(stockFile, promotionsFile string) int {
+	if _, _, err := config.ReadShop(stockFile, promotionsFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s and %s are valid\n", stockFile, promotionsFile)
+	return 0
+}
 
 func main() {
 	stockFileOpt := flag.String("stock", stockFile, "Stock YAML file")
 	promoFileOpt := flag.String("promotions", promotionsFile, "Promotions YAML file")
+	dbFileOpt := flag.String("db", "", "Database file to keep carts, orders and stock in across restarts (in memory only if empty)")
+	cartTTLOpt := flag.Duration("cart-ttl", defaultCartTTL, "Time a cart is kept after its last activity")
+	reapIntervalOpt := flag.Duration("reap-interval", defaultReapInterval, "Interval between sweeps for expired carts")
+	expiryWarningOpt := flag.Duration("expiry-warning", defaultExpiryWarning, "Time before a cart's expiry at which subscribers are warned")
+	reloadIntervalOpt := flag.Duration("reload-interval", defaultReloadInterval, "Interval between checks of the stock and promotions files for changes (0 to only reload on SIGHUP)")
+	strategyOpt := flag.String("promotion-strategy", store.BestForCustomer.String(), `How to pick between conflicting promotions, "best" for the customer or by "priority"`)
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [validate]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "With validate, the stock and promotions files are checked and the shop is not started.")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
 	flag.Parse()
-	stock, err := config.ReadInventory(*stockFileOpt)
+	switch flag.Arg(0) {
+	case "":
+	case "validate":
+		os.Exit(validate(*stockFileOpt, *promoFileOpt))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	stock, promotions, err := config.ReadShop(*stockFileOpt, *promoFileOpt)
 	if err != nil {
-		glog.Fatalf("Could not read inventory: %+v", err)
+		glog.Fatalf("Could not read configuration:\n%+v", err)
 	}
-	promotions, err := config.ReadPromotions(*promoFileOpt)
+	var shop *store.Shop
+	if *dbFileOpt == "" {
+		shop = store.NewMemoryShop()
+	} else {
+		var db *store.BoltDB
+		shop, db, err = openDatabase(*dbFileOpt)
+		if err != nil {
+			glog.Fatalf("Could not open database: %+v", err)
+		}
+		defer db.Close()
+	}
+	if len(shop.GetInventory()) == 0 {
+		if err := shop.StockShop(stock); err != nil {
+			glog.Fatalf("Inventory issue: %+v", err)
+		}
+	} else { // stored carts hold claims against the stored inventory
+		glog.Infof("Using stored inventory from %s instead of %s", *dbFileOpt, *stockFileOpt)
+	}
+	strategy, err := store.ParsePromotionStrategy(*strategyOpt)
 	if err != nil {
-		glog.Fatalf("Could not read promotions: %+v", err)
+		glog.Fatalf("Invalid promotion strategy: %+v", err)
+	}
+	shop.SetPromotionStrategy(strategy)
+	if err := shop.RegisterPromotions(promotions); err != nil {
+		glog.Fatalf("Could not register promotions: %+v", err)
 	}
-	store.InitShop()
-	if err := store.StockShop(stock); err != nil {
-		glog.Fatalf("Inventory issue: %+v", err)
+	if err := shop.SetCartTTL(*cartTTLOpt); err != nil {
+		glog.Fatalf("Invalid cart TTL: %+v", err)
 	}
-	store.RegisterPromotions(promotions)
+	shop.SetExpiryWarning(*expiryWarningOpt)
+	if *reapIntervalOpt <= 0 {
+		glog.Fatalf("Invalid reap interval: %s", *reapIntervalOpt)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	reaperDone := make(chan struct{})
+	go superviseReaper(ctx, shop, *reapIntervalOpt, reaperDone)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	reloader := config.NewReloader(shop, *stockFileOpt, *promoFileOpt, stock, promotions)
+	go reloader.Watch(ctx, *reloadIntervalOpt, hup)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = defaultPort
 	}
 
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &graph.Resolver{}}))
+	resolver := &graph.Resolver{
+		Shop:       shop,
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+	}
+	if resolver.AdminToken == "" {
+		glog.Infof("ADMIN_TOKEN is not set, admin queries and mutations are disabled")
+	}
+	srv := newServer(resolver.ExecutableSchema())
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", graph.WithBearerToken(srv))
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	httpServer := &http.Server{Addr: ":" + port}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("server shutdown failed: %+v", err)
+		}
+	}()
 
+	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-reaperDone
 }
@@ -3,9 +3,12 @@ module github.com/jsfan/fake-shop
 go 1.16
 
 require (
-	github.com/99designs/gqlgen v0.13.0 // indirect
+	github.com/99designs/gqlgen v0.13.0
 	github.com/golang/glog v0.0.0-20210429001901-424d2337a529
 	github.com/google/uuid v1.2.0
-	github.com/vektah/gqlparser/v2 v2.1.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/vektah/gqlparser/v2 v2.1.0
+	go.etcd.io/bbolt v1.3.6
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
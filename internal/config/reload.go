@@ -0,0 +1,117 @@
+package config
+
+import (
+	"context"
+	"github.com/golang/glog"
+	"github.com/jsfan/fake-shop/internal/store"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader applies changes to the stock and promotions files to a running shop
+type Reloader struct {
+	lock           sync.Mutex
+	shop           *store.Shop
+	stockFile      string
+	promotionsFile string
+	// stock and promotions are the versions of the files last applied
+	stock      []*store.Product
+	promotions []*store.Promotion
+	// modified records the modification time and size of each file when it was last checked
+	modified map[string]fileVersion
+}
+
+// fileVersion tells apart versions of a file without reading it
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader creates a reloader for a shop which was set up from the given stock and promotions
+func NewReloader(shop *store.Shop, stockFile, promotionsFile string, stock []*store.Product, promotions []*store.Promotion) *Reloader {
+	r := &Reloader{
+		shop:           shop,
+		stockFile:      stockFile,
+		promotionsFile: promotionsFile,
+		stock:          stock,
+		promotions:     promotions,
+		modified:       make(map[string]fileVersion),
+	}
+	r.changed()
+	return r
+}
+
+// changed checks if either file changed since the last check
+func (r *Reloader) changed() bool {
+	changed := false
+	for _, file := range []string{r.stockFile, r.promotionsFile} {
+		info, err := os.Stat(file)
+		if err != nil { // possibly being replaced, so check again later
+			continue
+		}
+		version := fileVersion{modTime: info.ModTime(), size: info.Size()}
+		if version != r.modified[file] {
+			r.modified[file] = version
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Reload reads and validates both files and applies any changes to the shop. If either file is invalid, the shop
+// is left unchanged.
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stock, promotions, err := ReadShop(r.stockFile, r.promotionsFile)
+	if err != nil {
+		return err
+	}
+	stockDiff := store.DiffStock(r.stock, stock)
+	if !stockDiff.Empty() {
+		if err := r.shop.MergeStock(stockDiff); err != nil {
+			return err
+		}
+		glog.Infof("Reloaded %s:\n%s", r.stockFile, stockDiff)
+	}
+	r.stock = stock
+	promotionDiff := store.DiffPromotions(r.promotions, promotions)
+	if !promotionDiff.Empty() {
+		if err := r.shop.RegisterPromotions(promotions); err != nil {
+			return err
+		}
+		glog.Infof("Reloaded %s:\n%s", r.promotionsFile, promotionDiff)
+	}
+	r.promotions = promotions
+	return nil
+}
+
+// Watch reloads the files whenever they change or a signal arrives on reload until the context is done. Files are
+// checked for changes every interval unless it is zero.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			r.lock.Lock()
+			changed := r.changed()
+			r.lock.Unlock()
+			if !changed {
+				continue
+			}
+		case sig := <-reload:
+			glog.Infof("Reloading configuration on %s", sig)
+		}
+		if err := r.Reload(); err != nil {
+			glog.Errorf("Could not reload configuration, keeping the previous version:\n%+v", err)
+		}
+	}
+}
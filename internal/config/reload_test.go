@@ -0,0 +1,77 @@
+package config_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/config"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const reloadStock = `- sku: A1234
+  name: Carrot
+  price: 1.1
+  stock: 10
+`
+
+const reloadPromotions = `- name: "10% off carrots"
+  sku: 10OFF
+  category: discount
+  requires:
+    sku: A1234
+    count: 1
+  rule:
+    discount: .1
+`
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Writing %s failed: %+v", path, err)
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	stockFile := filepath.Join(dir, "stock.yaml")
+	promotionsFile := filepath.Join(dir, "promotions.yaml")
+	writeFile(t, stockFile, reloadStock)
+	writeFile(t, promotionsFile, reloadPromotions)
+	stock, promotions, err := config.ReadShop(stockFile, promotionsFile)
+	if err != nil {
+		t.Fatalf("Reading configuration failed: %+v", err)
+	}
+	shop := store.NewMemoryShop()
+	if err := shop.StockShop(stock); err != nil {
+		t.Fatalf("Stocking shop failed: %+v", err)
+	}
+	if err := shop.RegisterPromotions(promotions); err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	reloader := config.NewReloader(shop, stockFile, promotionsFile, stock, promotions)
+	_, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 4}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+
+	writeFile(t, stockFile, reloadStock+"- sku: B1234\n  name: Stick\n  price: 0.1\n  stock: 5\n")
+	writeFile(t, promotionsFile, "[]\n")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Reloading failed: %+v", err)
+	}
+	inventory := shop.GetInventory()
+	if inventory["A1234"].Count != 6 || inventory["B1234"] == nil || inventory["B1234"].Count != 5 {
+		t.Errorf("Unexpected inventory after reload: %+v", inventory)
+	}
+	if _, promo, _ := cart.Get(); len(promo) != 0 {
+		t.Errorf("Removed promotion still applied: %+v", promo)
+	}
+
+	writeFile(t, stockFile, "- sku: A1234\n  name: Carrot\n  price: -1\n  stock: 10\n")
+	if err := reloader.Reload(); err == nil {
+		t.Error("Reloading an invalid stock file did not throw an error.")
+	}
+	if carrot := shop.GetInventory()["A1234"]; carrot.Price != money.MustParse("1.1") {
+		t.Errorf("Invalid stock file changed the inventory: %+v", carrot)
+	}
+}
@@ -1,45 +1,135 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/jsfan/fake-shop/internal/store"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"os"
 )
 
-// ReadInventory reads the inventory from a YAML file
-func ReadInventory(inputFile string) ([]*store.Product, error) {
-	inventoryFile, err := os.Open(inputFile)
+// readEntries reads the entries of a YAML file holding a list
+func readEntries(inputFile, kind string) ([]*yaml.Node, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s file: %w", kind, err)
+	}
+	defer file.Close()
+	in, err := ioutil.ReadAll(file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open inventory file: %w", err)
+		return nil, fmt.Errorf("failed to read %s file: %w", kind, err)
+	}
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(in, root); err != nil {
+		return nil, fmt.Errorf("failed to parse %s file: %w", kind, err)
+	}
+	if root.Kind == 0 { // empty file
+		return nil, nil
+	}
+	if root.Kind == yaml.DocumentNode && len(root.Content) == 1 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("failed to parse %s file: line %d: expected a list", kind, root.Line)
 	}
-	inventoryIn, err := ioutil.ReadAll(inventoryFile)
+	return root.Content, nil
+}
+
+// loadInventory reads an inventory file and collects the problems with its products
+func loadInventory(inputFile string) ([]*store.Product, []*yaml.Node, *problems, error) {
+	nodes, err := readEntries(inputFile, "inventory")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+		return nil, nil, nil, err
 	}
-	inventory := make([]*store.Product, 0)
-	err = yaml.Unmarshal(inventoryIn, &inventory)
+	found := &problems{file: inputFile}
+	inventory := make([]*store.Product, 0, len(nodes))
+	for _, node := range nodes {
+		product := &store.Product{}
+		if err := node.Decode(product); err != nil {
+			found.addDecodeError(node, err)
+			product = nil
+		}
+		inventory = append(inventory, product)
+	}
+	inventory = store.ResolveVariants(inventory)
+	validateInventory(found, nodes, inventory)
+	return inventory, nodes, found, nil
+}
+
+// loadPromotions reads a promotions file and collects the problems with its promotions
+func loadPromotions(inputFile string) ([]*store.Promotion, []*yaml.Node, *problems, error) {
+	nodes, err := readEntries(inputFile, "promotions")
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse inventory file: %w", err)
+		return nil, nil, nil, err
+	}
+	found := &problems{file: inputFile}
+	promotions := make([]*store.Promotion, 0, len(nodes))
+	for _, node := range nodes {
+		promotion := &store.Promotion{}
+		if err := node.Decode(promotion); err != nil {
+			found.addDecodeError(node, err)
+			promotion = nil
+		}
+		promotions = append(promotions, promotion)
+	}
+	validatePromotions(found, nodes, promotions)
+	return promotions, nodes, found, nil
+}
+
+// ReadInventory reads the inventory from a YAML file
+func ReadInventory(inputFile string) ([]*store.Product, error) {
+	inventory, _, found, err := loadInventory(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := merge(found); err != nil {
+		return nil, fmt.Errorf("invalid inventory file: %w", err)
 	}
 	return inventory, nil
 }
 
 // ReadPromotions reads the promotions to be applied to purchases
 func ReadPromotions(inputFile string) ([]*store.Promotion, error) {
-	promotionsFile, err := os.Open(inputFile)
+	promotions, _, found, err := loadPromotions(inputFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open promotions file: %w", err)
+		return nil, err
+	}
+	if err := merge(found); err != nil {
+		return nil, fmt.Errorf("invalid promotions file: %w", err)
 	}
-	promotionsIn, err := ioutil.ReadAll(promotionsFile)
+	return promotions, nil
+}
+
+// ReadShop reads the inventory and the promotions and checks that they fit together. All problems found in
+// either file are reported at once in a ValidationError.
+func ReadShop(stockFile, promotionsFile string) ([]*store.Product, []*store.Promotion, error) {
+	inventory, _, stockProblems, err := loadInventory(stockFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read promotions file: %w", err)
+		return nil, nil, err
 	}
-	promotions := make([]*store.Promotion, 0)
-	err = yaml.Unmarshal(promotionsIn, &promotions)
+	promotions, promoNodes, promoProblems, err := loadPromotions(promotionsFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse promotions file: %w", err)
+		return nil, nil, err
 	}
-	return promotions, nil
+	validateReferences(promoProblems, promoNodes, promotions, inventory)
+	validateCurrencies(promoProblems, promoNodes, promotions, inventory)
+	if err := merge(stockProblems, promoProblems); err != nil {
+		return nil, nil, err
+	}
+	return inventory, promotions, nil
+}
+
+// ExportPromotions writes promotions as YAML which ReadPromotions can read back
+func ExportPromotions(promotions []*store.Promotion) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(promotions); err != nil {
+		return nil, fmt.Errorf("failed to export promotions: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to export promotions: %w", err)
+	}
+	return out.Bytes(), nil
 }
@@ -2,24 +2,43 @@ package config_test
 
 import (
 	"github.com/jsfan/fake-shop/internal/config"
+	"github.com/jsfan/fake-shop/internal/money"
 	"github.com/jsfan/fake-shop/internal/store"
+	"io/ioutil"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestReadInventory(t *testing.T) {
 	expectedStock := []store.Product{
 		{
-			SKU:   "1234",
-			Name:  "Some Item",
-			Price: 9.99,
-			Count: 12,
+			SKU:         "1234",
+			Name:        "Some Item",
+			Price:       money.MustParse("9.99"),
+			Count:       12,
+			Brand:       "Acme",
+			Description: "Something you need.",
+			Categories:  []string{"Tools", "Tools/Hand Tools"},
+			Images:      []string{"https://example.com/images/1234.jpg"},
+			Attributes:  map[string]string{"colour": "red", "weight": "1 kg"},
 		},
 		{
 			SKU:   "ABC123",
 			Name:  "Another Item",
-			Price: 123.45,
+			Price: money.MustParse("123.45"),
 			Count: 22,
+			Tiers: []store.PriceTier{
+				{
+					MinCount: 5,
+					Discount: money.MustParseRate(".05"),
+				},
+				{
+					MinCount: 10,
+					Price:    money.MustParse("100"),
+				},
+			},
 		},
 	}
 	_, err := config.ReadInventory("missing.yaml")
@@ -74,7 +93,74 @@ func TestReadPromotions(t *testing.T) {
 			Rule: store.RuleDetail{
 				SKU:      "",
 				Count:    0,
-				Discount: 1.,
+				Discount: money.MustParseRate("1."),
+			},
+		},
+		{
+			SKU:         "SAVE5",
+			Name:        "A coupon",
+			Category:    "discount",
+			Code:        "SAVE5",
+			MaxUses:     10,
+			CodeExpires: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			Requires: store.Requirement{
+				SKU:   "98765",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".05"),
+			},
+		},
+		{
+			SKU:        "WEEKEND",
+			Name:       "A weekend sale",
+			Category:   "discount",
+			Priority:   5,
+			Group:      "seasonal",
+			Stackable:  true,
+			ValidFrom:  time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			ValidUntil: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+			Schedule: &store.Schedule{
+				Days:     []store.Weekday{store.Weekday(time.Saturday), store.Weekday(time.Sunday)},
+				From:     8 * 60,
+				Until:    20 * 60,
+				Timezone: "Europe/Berlin",
+			},
+			Requires: store.Requirement{
+				SKU:   "98765",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".2"),
+			},
+		},
+		{
+			SKU:      "5OVER50",
+			Name:     "5 off orders over 50",
+			Category: "cart",
+			Requires: store.Requirement{
+				MinSpend: money.MustParse("50"),
+			},
+			Rule: store.RuleDetail{
+				Amount: money.MustParse("5"),
+			},
+		},
+		{
+			SKU:      "KIT",
+			Name:     "A kit",
+			Category: "bundle",
+			Bundle: []store.Requirement{
+				{
+					SKU:   "ABC123",
+					Count: 1,
+				},
+				{
+					SKU:   "98765",
+					Count: 2,
+				},
+			},
+			Rule: store.RuleDetail{
+				Price: money.MustParse("199.99"),
 			},
 		},
 	}
@@ -90,6 +176,12 @@ func TestReadPromotions(t *testing.T) {
 	} else if err.Error()[:32] != "failed to parse promotions file:" {
 		t.Errorf("Got unexpected error when loading incorrectly formatted YAML file: %+v", err)
 	}
+	_, err = config.ReadPromotions("../../test/data/invalid_bundle_promotions.yaml")
+	if err == nil {
+		t.Error("Loading an invalid bundle promotion did not throw an error.")
+	} else if err.Error()[:24] != "invalid promotions file:" {
+		t.Errorf("Got unexpected error when loading invalid bundle promotion: %+v", err)
+	}
 	promotions, err := config.ReadPromotions("../../test/data/good_promotions.yaml")
 	if err != nil {
 		t.Errorf("Got an unexpected error when loading good promotions file: %+v", err)
@@ -102,3 +194,53 @@ func TestReadPromotions(t *testing.T) {
 		t.Errorf("Loaded promotions are not as expected. Expected %+v, got %+v.", expectedPromotions, promoCopy)
 	}
 }
+
+func TestReadShop(t *testing.T) {
+	_, _, err := config.ReadShop("../../test/data/good_stock.yaml", "../../test/data/invalid_promotions.yaml")
+	validationErr, ok := err.(*config.ValidationError)
+	if !ok {
+		t.Fatalf("Did not get a validation error: %+v", err)
+	}
+	expectedLines := []int{1, 7, 20, 30, 40, 48, 55, 65, 66}
+	lines := make([]int, 0)
+	for _, p := range validationErr.Problems {
+		lines = append(lines, p.Line)
+		if p.File != "../../test/data/invalid_promotions.yaml" {
+			t.Errorf("Problem reported in wrong file: %s", p)
+		}
+	}
+	if !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Problems reported on unexpected lines. Expected %+v, got %+v (%s).", expectedLines, lines, err)
+	}
+
+	stock, promotions, err := config.ReadShop("../../config/stock.yaml", "../../config/promotions.yaml")
+	if err != nil {
+		t.Fatalf("Sample configuration is invalid: %+v", err)
+	}
+	if len(stock) == 0 || len(promotions) == 0 {
+		t.Errorf("Sample configuration not loaded. Got %d products and %d promotions.", len(stock), len(promotions))
+	}
+}
+
+func TestExportPromotions(t *testing.T) {
+	promotions, err := config.ReadPromotions("../../test/data/good_promotions.yaml")
+	if err != nil {
+		t.Fatalf("Loading promotions failed: %+v", err)
+	}
+	promotions[0].Disabled = true
+	exported, err := config.ExportPromotions(promotions)
+	if err != nil {
+		t.Fatalf("Exporting promotions failed: %+v", err)
+	}
+	exportFile := filepath.Join(t.TempDir(), "promotions.yaml")
+	if err := ioutil.WriteFile(exportFile, exported, 0644); err != nil {
+		t.Fatalf("Writing exported promotions failed: %+v", err)
+	}
+	reread, err := config.ReadPromotions(exportFile)
+	if err != nil {
+		t.Fatalf("Reading exported promotions failed: %+v\n%s", err, exported)
+	}
+	if !reflect.DeepEqual(reread, promotions) {
+		t.Errorf("Exported promotions do not read back the same. Expected %+v, got %+v.", promotions, reread)
+	}
+}
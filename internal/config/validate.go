@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+// Problem is an issue found in a configuration file
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// ValidationError lists every problem found in configuration files
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// problems collects the problems found in one file
+type problems struct {
+	file  string
+	found []Problem
+}
+
+// add records a problem at the line of a node
+func (p *problems) add(node *yaml.Node, format string, args ...interface{}) {
+	p.found = append(p.found, Problem{
+		File:    p.file,
+		Line:    node.Line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// addDecodeError records the problems yaml found decoding an entry. Type errors carry their own line numbers.
+func (p *problems) addDecodeError(node *yaml.Node, err error) {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		p.add(node, "%s", strings.TrimPrefix(err.Error(), "yaml: "))
+		return
+	}
+	for _, msg := range typeErr.Errors {
+		line := node.Line
+		if n, _ := fmt.Sscanf(msg, "line %d:", &line); n == 1 {
+			msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+		}
+		p.found = append(p.found, Problem{
+			File:    p.file,
+			Line:    line,
+			Message: msg,
+		})
+	}
+}
+
+// merge combines the problems found in several files into one error, or nil if there are none. The problems of
+// each file are in order of their lines.
+func merge(all ...*problems) error {
+	merged := &ValidationError{}
+	for _, p := range all {
+		found := append([]Problem{}, p.found...)
+		sort.SliceStable(found, func(i, j int) bool {
+			return found[i].Line < found[j].Line
+		})
+		merged.Problems = append(merged.Problems, found...)
+	}
+	if len(merged.Problems) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// field finds the node of a value by its path of keys in a mapping. If the value is missing, the closest node on
+// the path is returned.
+func field(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return node
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return node
+		}
+	}
+	return node
+}
+
+// element finds the node of an item in a sequence. If the item is missing, the sequence's node is returned.
+func element(node *yaml.Node, i int) *yaml.Node {
+	if node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return node
+	}
+	return node.Content[i]
+}
+
+// validateInventory checks every product in an inventory file
+func validateInventory(found *problems, nodes []*yaml.Node, stock []*store.Product) {
+	seen := make(map[string]bool, len(stock))
+	parents := make(map[string]*store.Product, len(stock))
+	for _, p := range stock {
+		if p != nil {
+			parents[p.SKU] = p
+		}
+	}
+	currency := ""
+	for i, p := range stock {
+		if p == nil {
+			continue
+		}
+		if p.Parent != "" {
+			parent, ok := parents[p.Parent]
+			switch {
+			case p.Parent == p.SKU:
+				found.add(field(nodes[i], "parent"), `SKU "%s" is its own parent`, p.SKU)
+			case !ok:
+				found.add(field(nodes[i], "parent"), `parent "%s" of SKU "%s" does not exist`, p.Parent, p.SKU)
+			case parent.Parent != "":
+				found.add(field(nodes[i], "parent"), `parent "%s" of SKU "%s" is a variant itself`, p.Parent, p.SKU)
+			}
+		}
+		if err := p.Validate(); err != nil {
+			found.add(nodes[i], "%s", err)
+		}
+		if seen[p.SKU] {
+			found.add(field(nodes[i], "sku"), `duplicate SKU "%s"`, p.SKU)
+		}
+		seen[p.SKU] = true
+		switch {
+		case p.Parent != "" && parents[p.Parent] == nil: // its price may be missing as it could not be resolved
+		case currency == "":
+			currency = p.Price.Currency
+		case p.Price.Currency != currency:
+			found.add(field(nodes[i], "price"), `SKU "%s" is priced in %s but the shop uses %s`, p.SKU, p.Price.Currency, currency)
+		}
+	}
+}
+
+// validatePromotions checks every promotion in a promotions file
+func validatePromotions(found *problems, nodes []*yaml.Node, promos []*store.Promotion) {
+	skus := make(map[string]bool, len(promos))
+	codes := make(map[string]bool)
+	for i, p := range promos {
+		if p == nil {
+			continue
+		}
+		if err := p.Validate(); err != nil {
+			found.add(nodes[i], "%s", err)
+		}
+		if p.SKU != "" && skus[p.SKU] {
+			found.add(field(nodes[i], "sku"), `duplicate promotion SKU "%s"`, p.SKU)
+		}
+		skus[p.SKU] = true
+		if p.Code == "" {
+			continue
+		}
+		code := strings.ToUpper(strings.TrimSpace(p.Code))
+		if codes[code] {
+			found.add(field(nodes[i], "code"), `duplicate coupon code "%s"`, code)
+		}
+		codes[code] = true
+	}
+}
+
+// validateReferences checks that the products promotions refer to are stocked
+func validateReferences(found *problems, nodes []*yaml.Node, promos []*store.Promotion, stock []*store.Product) {
+	stocked := make(map[string]bool, len(stock))
+	for _, p := range stock {
+		if p != nil {
+			stocked[p.SKU] = true
+		}
+	}
+	for i, p := range promos {
+		if p == nil {
+			continue
+		}
+		if p.Requires.SKU != "" && !stocked[p.Requires.SKU] {
+			found.add(field(nodes[i], "requires", "sku"), `promotion "%s" requires SKU "%s" which is not in stock`, p.SKU, p.Requires.SKU)
+		}
+		if p.Rule.SKU != "" && !stocked[p.Rule.SKU] {
+			found.add(field(nodes[i], "rule", "sku"), `promotion "%s" rewards SKU "%s" which is not in stock`, p.SKU, p.Rule.SKU)
+		}
+		for j, item := range p.Bundle {
+			if !stocked[item.SKU] {
+				found.add(field(element(field(nodes[i], "bundle"), j), "sku"), `bundle promotion "%s" includes SKU "%s" which is not in stock`, p.SKU, item.SKU)
+			}
+		}
+	}
+}
+
+// validateCurrencies checks that the amounts in promotions are in the currency the shop's products are priced in
+func validateCurrencies(found *problems, nodes []*yaml.Node, promos []*store.Promotion, stock []*store.Product) {
+	currency := ""
+	for _, p := range stock {
+		if p != nil && p.Price.Currency != "" {
+			currency = p.Price.Currency
+			break
+		}
+	}
+	if currency == "" {
+		return
+	}
+	for i, p := range promos {
+		if p == nil {
+			continue
+		}
+		amounts := []money.Money{p.Requires.MinSpend, p.Rule.Amount, p.Rule.Price}
+		amountNodes := []*yaml.Node{
+			field(nodes[i], "requires", "minSpend"),
+			field(nodes[i], "rule", "amount"),
+			field(nodes[i], "rule", "price"),
+		}
+		for j, tier := range p.Tiers {
+			amounts = append(amounts, tier.Price)
+			amountNodes = append(amountNodes, field(element(field(nodes[i], "tiers"), j), "price"))
+		}
+		for j, amount := range amounts {
+			if !amount.IsZero() && amount.Currency != currency {
+				found.add(amountNodes[j], `promotion "%s" is in %s but the shop uses %s`, p.SKU, amount.Currency, currency)
+			}
+		}
+	}
+}
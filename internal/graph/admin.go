@@ -0,0 +1,45 @@
+package graph
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// contextKey keys values the HTTP layer passes on to resolvers
+type contextKey struct {
+	name string
+}
+
+var bearerTokenKey = &contextKey{"bearerToken"}
+
+var errAdminRequired = errors.New("admin access required")
+
+// ContextWithBearerToken adds the bearer token a request was made with to its context
+func ContextWithBearerToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, bearerTokenKey, token)
+}
+
+// WithBearerToken passes the bearer token of a request on to the resolvers
+func WithBearerToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if token := strings.TrimPrefix(auth, "Bearer "); token != auth {
+			r = r.WithContext(ContextWithBearerToken(r.Context(), strings.TrimSpace(token)))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Admin implements the @admin directive which only resolves a field for requests carrying the admin token
+func (r *Resolver) Admin(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	token, _ := ctx.Value(bearerTokenKey).(string)
+	if r.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(r.AdminToken)) != 1 {
+		return nil, errAdminRequired
+	}
+	return next(ctx)
+}
@@ -0,0 +1,270 @@
+package graph_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/jsfan/fake-shop/internal/graph"
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestResolver_Admin(t *testing.T) {
+	next := func(ctx context.Context) (interface{}, error) {
+		return "resolved", nil
+	}
+	resolver := &graph.Resolver{AdminToken: "secret"}
+	for token, allowed := range map[string]bool{"": false, "wrong": false, "secret": true} {
+		ctx := context.Background()
+		if token != "" {
+			ctx = graph.ContextWithBearerToken(ctx, token)
+		}
+		res, err := resolver.Admin(ctx, nil, next)
+		if allowed && (err != nil || res != "resolved") {
+			t.Errorf("Admin token %q rejected: %+v", token, err)
+		}
+		if !allowed && err == nil {
+			t.Errorf("Token %q accepted as admin token.", token)
+		}
+	}
+	disabled := &graph.Resolver{}
+	if _, err := disabled.Admin(graph.ContextWithBearerToken(context.Background(), ""), nil, next); err == nil {
+		t.Error("Admin access granted without an admin token configured.")
+	}
+}
+
+func TestResolver_ExecutableSchemaAdmin(t *testing.T) {
+	resolver, _ := setupStressShop(t)
+	resolver.AdminToken = "secret"
+	schema := resolver.ExecutableSchema()
+	public := map[string]bool{
+		"cart": true, "products": true, "product": true, "order": true, "orders": true, "promotions": true,
+		"addProduct": true, "updateCart": true, "removeProduct": true, "clearCart": true, "applyCoupon": true,
+		"removeCoupon": true, "checkout": true,
+	}
+	for _, root := range []*ast.Definition{schema.Schema().Query, schema.Schema().Mutation} {
+		for _, field := range root.Fields {
+			if strings.HasPrefix(field.Name, "__") || public[field.Name] {
+				continue
+			}
+			if field.Directives.ForName("admin") == nil {
+				t.Errorf("Field %s.%s is not restricted to admins.", root.Name, field.Name)
+			}
+		}
+	}
+
+	c := client.New(graph.WithBearerToken(handler.NewDefaultServer(schema)))
+	mutations := []string{
+		`mutation { restock(sku: "A1234", count: 5) { sku } }`,
+		`mutation { deletePromotion(sku: "DISCOUNT") { sku } }`,
+	}
+	for _, mutation := range mutations {
+		for _, token := range []string{"", "wrong"} {
+			var resp map[string]interface{}
+			err := c.Post(mutation, &resp, client.AddHeader("Authorization", "Bearer "+token))
+			if err == nil || !strings.Contains(err.Error(), "admin access required") {
+				t.Errorf("Mutation %s with token %q not rejected: %+v", mutation, token, err)
+			}
+		}
+	}
+	if count := resolver.Shop.GetInventory()["A1234"].Count; count != 100 {
+		t.Errorf("Rejected restock changed stock. Expected 100, got %d.", count)
+	}
+	if promos := resolver.Shop.Promotions(); len(promos) != 1 {
+		t.Errorf("Rejected deletion removed a promotion: %+v", promos)
+	}
+
+	var resp struct {
+		Restock struct{ Count int }
+	}
+	err := c.Post(`mutation { restock(sku: "A1234", count: 5) { count } }`, &resp, client.AddHeader("Authorization", "Bearer secret"))
+	if err != nil || resp.Restock.Count != 105 {
+		t.Errorf("Restock with the admin token failed. Expected 105, got %d (%+v).", resp.Restock.Count, err)
+	}
+}
+
+func TestResolvers_ManageInventory(t *testing.T) {
+	t.Parallel()
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	hatPrice := money.MustParse("5")
+	_, err := resolver.Mutation().CreateProduct(ctx, model.NewProduct{
+		Sku:   "C1234",
+		Name:  "Hat",
+		Price: &hatPrice,
+		Count: 2,
+	})
+	if err != nil {
+		t.Fatalf("Creating product failed: %+v", err)
+	}
+	if product, err := resolver.Mutation().Restock(ctx, "C1234", 3); err != nil || *product.Count != 5 {
+		t.Errorf("Unexpected product after restocking: %+v (%+v)", product, err)
+	}
+	if _, err := resolver.Mutation().DiscontinueProduct(ctx, "C1234"); err != nil {
+		t.Fatalf("Discontinuing product failed: %+v", err)
+	}
+	products, err := resolver.Query().Products(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Could not retrieve products: %+v", err)
+	}
+	for _, edge := range products.Edges {
+		if edge.Node.Sku == "C1234" {
+			t.Error("Discontinued product still listed.")
+		}
+	}
+	inventory, err := resolver.Query().AdminInventory(ctx)
+	if err != nil {
+		t.Fatalf("Could not retrieve inventory: %+v", err)
+	}
+	if len(inventory) != 3 || inventory[2].Sku != "C1234" || !inventory[2].Discontinued || *inventory[2].Count != 5 {
+		t.Errorf("Unexpected admin inventory: %+v", inventory)
+	}
+}
+
+func TestResolvers_ManagePromotions(t *testing.T) {
+	t.Parallel()
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	sku, count, discount, code := "A1234", 3, "0.2", "CARROTS"
+	input := model.PromotionInput{
+		Sku:      "CARROTS",
+		Name:     "20% off 3 carrots",
+		Category: "discount",
+		Code:     &code,
+		Requires: &model.RequirementInput{Sku: &sku, Count: &count},
+		Rule:     &model.RuleInput{Discount: &discount},
+		Schedule: &model.ScheduleInput{Days: []string{"fri"}},
+	}
+	created, err := resolver.Mutation().CreatePromotion(ctx, input)
+	if err != nil {
+		t.Fatalf("Creating promotion failed: %+v", err)
+	}
+	if created.Requirement != `3 x "A1234"` || !created.Enabled || *created.Code != "CARROTS" {
+		t.Errorf("Unexpected promotion: %+v", created)
+	}
+	invalid := "3"
+	input.Rule.Discount = &invalid
+	if _, err := resolver.Mutation().UpdatePromotion(ctx, "CARROTS", input); err == nil {
+		t.Error("Updating to an invalid discount did not throw an error.")
+	}
+	input.Schedule = nil
+	input.Code = nil
+	input.Rule.Discount = &discount
+	if _, err := resolver.Mutation().UpdatePromotion(ctx, "CARROTS", input); err != nil {
+		t.Fatalf("Updating promotion failed: %+v", err)
+	}
+	active, err := resolver.Query().Promotions(ctx)
+	if err != nil || len(active) != 2 {
+		t.Errorf("Unexpected active promotions: %+v (%+v)", active, err)
+	}
+	if disabled, err := resolver.Mutation().SetPromotionEnabled(ctx, "DISCOUNT", false); err != nil || disabled.Enabled {
+		t.Errorf("Unexpected promotion after disabling: %+v (%+v)", disabled, err)
+	}
+	if active, _ := resolver.Query().Promotions(ctx); len(active) != 1 || active[0].Sku != "CARROTS" {
+		t.Errorf("Unexpected active promotions after disabling: %+v", active)
+	}
+	exported, err := resolver.Query().ExportPromotions(ctx)
+	if err != nil {
+		t.Fatalf("Exporting promotions failed: %+v", err)
+	}
+	if !strings.Contains(exported, "disabled: true") || !strings.Contains(exported, "sku: CARROTS") {
+		t.Errorf("Unexpected export:\n%s", exported)
+	}
+	if _, err := resolver.Mutation().DeletePromotion(ctx, "DISCOUNT"); err != nil {
+		t.Fatalf("Deleting promotion failed: %+v", err)
+	}
+	if all, _ := resolver.Query().AdminPromotions(ctx); len(all) != 1 {
+		t.Errorf("Unexpected promotions after deleting: %+v", all)
+	}
+}
+
+func TestResolvers_ProductCatalogue(t *testing.T) {
+	t.Parallel()
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	brand, hatPrice, inStock := "Acme", money.MustParse("5"), model.AvailabilityInStock
+	_, err := resolver.Mutation().CreateProduct(ctx, model.NewProduct{
+		Sku:        "C1234",
+		Name:       "Hat",
+		Price:      &hatPrice,
+		Count:      2,
+		Brand:      &brand,
+		Categories: []string{"Clothing/Hats"},
+		Images:     []string{"https://example.com/hat.jpg"},
+		Attributes: []*model.AttributeInput{{Name: "size", Value: "M"}, {Name: "colour", Value: "red"}},
+	})
+	if err != nil {
+		t.Fatalf("Creating product failed: %+v", err)
+	}
+	product, err := resolver.Query().Product(ctx, "C1234")
+	if err != nil || product == nil {
+		t.Fatalf("Could not retrieve product: %+v", err)
+	}
+	expected := &model.Product{
+		Sku:          "C1234",
+		Name:         "Hat",
+		Price:        money.MustParse("5"),
+		Brand:        &brand,
+		Categories:   []string{"Clothing/Hats"},
+		Images:       []string{"https://example.com/hat.jpg"},
+		Attributes:   []*model.Attribute{{Name: "colour", Value: "red"}, {Name: "size", Value: "M"}},
+		Availability: &inStock,
+	}
+	if !reflect.DeepEqual(product, expected) {
+		t.Errorf("Unexpected product. Expected %+v, got %+v.", expected, product)
+	}
+	description := "A red hat"
+	if _, err := resolver.Mutation().UpdateProduct(ctx, model.ProductUpdate{Sku: "C1234", Description: &description}); err != nil {
+		t.Fatalf("Updating product failed: %+v", err)
+	}
+	if product, _ := resolver.Query().Product(ctx, "C1234"); product.Description == nil || *product.Description != description {
+		t.Errorf("Description not updated: %+v", product)
+	}
+	if _, err := resolver.Mutation().DiscontinueProduct(ctx, "C1234"); err != nil {
+		t.Fatalf("Discontinuing product failed: %+v", err)
+	}
+	for _, sku := range []string{"C1234", "Z9999"} {
+		if product, err := resolver.Query().Product(ctx, sku); err != nil || product != nil {
+			t.Errorf("Unexpected product %s: %+v (%+v)", sku, product, err)
+		}
+	}
+}
+
+func TestResolvers_ProductVariants(t *testing.T) {
+	t.Parallel()
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	parent := "A1234"
+	for _, variant := range []model.NewProduct{
+		{Sku: "A1234-P", Name: "Purple Carrot", Count: 3, ParentSku: &parent},
+		{Sku: "A1234-W", Name: "White Carrot", Count: 3, ParentSku: &parent},
+	} {
+		if _, err := resolver.Mutation().CreateProduct(ctx, variant); err != nil {
+			t.Fatalf("Creating variant failed: %+v", err)
+		}
+	}
+	products, err := resolver.Query().Products(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Could not retrieve products: %+v", err)
+	}
+	for _, edge := range products.Edges {
+		if edge.Node.ParentSku != nil {
+			t.Errorf("Variant %s listed next to its parent.", edge.Node.Sku)
+		}
+	}
+	product, err := resolver.Query().Product(ctx, "A1234")
+	if err != nil || product == nil {
+		t.Fatalf("Could not retrieve product: %+v", err)
+	}
+	if len(product.Variants) != 2 || product.Variants[0].Sku != "A1234-P" || product.Variants[1].Price != money.MustParse("1.1") {
+		t.Errorf("Unexpected variants: %+v", product.Variants)
+	}
+	if variant, _ := resolver.Query().Product(ctx, "A1234-W"); variant == nil || variant.ParentSku == nil || *variant.ParentSku != "A1234" {
+		t.Errorf("Unexpected variant: %+v", variant)
+	}
+}
@@ -2,8 +2,26 @@ package graph
 
 //go:generate go run github.com/99designs/gqlgen
 
+import (
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/jsfan/fake-shop/internal/graph/generated"
+	"github.com/jsfan/fake-shop/internal/store"
+)
+
 // This file will not be regenerated automatically.
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
-type Resolver struct{}
+type Resolver struct {
+	Shop *store.Shop
+	// AdminToken is the bearer token required for admin fields. Admin fields are disabled without it.
+	AdminToken string
+}
+
+// ExecutableSchema creates the schema served by the shop with the resolvers and the @admin directive wired up
+func (r *Resolver) ExecutableSchema() graphql.ExecutableSchema {
+	return generated.NewExecutableSchema(generated.Config{
+		Resolvers:  r,
+		Directives: generated.DirectiveRoot{Admin: r.Admin},
+	})
+}
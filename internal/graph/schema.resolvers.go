@@ -8,6 +8,7 @@ import (
 	"errors"
 
 	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/config"
 	"github.com/jsfan/fake-shop/internal/graph/generated"
 	"github.com/jsfan/fake-shop/internal/graph/model"
 	"github.com/jsfan/fake-shop/internal/store"
@@ -23,7 +24,7 @@ func (r *mutationResolver) AddProduct(ctx context.Context, input model.Additiona
 			return nil, errors.New("invalid Cart ID")
 		}
 	}
-	_, cart := store.RetrieveCart(&cartUUID)
+	_, cart := r.Shop.RetrieveCart(&cartUUID)
 	newProduct := &store.Product{
 		SKU:   input.Item.Product,
 		Count: input.Item.Count,
@@ -44,8 +45,8 @@ func (r *mutationResolver) UpdateCart(ctx context.Context, input model.NewCart)
 			return nil, errors.New("invalid Cart ID")
 		}
 	}
-	_, cart := store.RetrieveCart(&cartUUID)
-	cart, errorList, err := transform.LoadCart(input)
+	_, cart := r.Shop.RetrieveCart(&cartUUID)
+	cart, errorList, err := transform.LoadCart(r.Shop, input)
 	if err != nil {
 		return nil, err
 	}
@@ -53,18 +54,174 @@ func (r *mutationResolver) UpdateCart(ctx context.Context, input model.NewCart)
 	if err != nil {
 		return nil, err
 	}
-	errorStrings := make([]string, 0)
-	if errorList != nil {
-		for _, e := range errorList {
-			errorStrings = append(errorStrings, e.Error())
-		}
+	transform.AddErrors(outCart, errorList...)
+	return outCart, nil
+}
+
+func (r *mutationResolver) RemoveProduct(ctx context.Context, cartID string, sku string, count int) (*model.Cart, error) {
+	cartUUID, err := uuid.Parse(cartID)
+	if err != nil {
+		return nil, errors.New("invalid Cart ID")
+	}
+	cart, exists := r.Shop.ExistingCart(cartUUID)
+	if !exists {
+		return nil, errors.New("cart does not exist")
+	}
+	err = cart.Remove(&store.Product{
+		SKU:   sku,
+		Count: count,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transform.RefreshCart(cartUUID.String(), cart)
+}
+
+func (r *mutationResolver) ClearCart(ctx context.Context, cartID string) (*model.Cart, error) {
+	cartUUID, err := uuid.Parse(cartID)
+	if err != nil {
+		return nil, errors.New("invalid Cart ID")
 	}
-	if outCart.Errors != nil {
-		outCart.Errors = append(errorStrings, outCart.Errors...)
+	cart, exists := r.Shop.ExistingCart(cartUUID)
+	if !exists {
+		return nil, errors.New("cart does not exist")
+	}
+	if err := cart.Clear(); err != nil {
+		return nil, err
+	}
+	return transform.RefreshCart(cartUUID.String(), cart)
+}
+
+func (r *mutationResolver) ApplyCoupon(ctx context.Context, cartID string, code string) (*model.Cart, error) {
+	cartUUID, err := uuid.Parse(cartID)
+	if err != nil {
+		return nil, errors.New("invalid Cart ID")
+	}
+	cart, exists := r.Shop.ExistingCart(cartUUID)
+	if !exists {
+		return nil, errors.New("cart does not exist")
+	}
+	couponErr := cart.ApplyCoupon(code)
+	outCart, err := transform.RefreshCart(cartUUID.String(), cart)
+	if err != nil {
+		return nil, err
+	}
+	if couponErr != nil {
+		transform.AddErrors(outCart, couponErr)
 	}
 	return outCart, nil
 }
 
+func (r *mutationResolver) RemoveCoupon(ctx context.Context, cartID string, code string) (*model.Cart, error) {
+	cartUUID, err := uuid.Parse(cartID)
+	if err != nil {
+		return nil, errors.New("invalid Cart ID")
+	}
+	cart, exists := r.Shop.ExistingCart(cartUUID)
+	if !exists {
+		return nil, errors.New("cart does not exist")
+	}
+	couponErr := cart.RemoveCoupon(code)
+	outCart, err := transform.RefreshCart(cartUUID.String(), cart)
+	if err != nil {
+		return nil, err
+	}
+	if couponErr != nil {
+		transform.AddErrors(outCart, couponErr)
+	}
+	return outCart, nil
+}
+
+func (r *mutationResolver) Checkout(ctx context.Context, cartID string) (*model.Order, error) {
+	cartUUID, err := uuid.Parse(cartID)
+	if err != nil {
+		return nil, errors.New("invalid Cart ID")
+	}
+	order, err := r.Shop.Checkout(cartUUID)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertOrder(order), nil
+}
+
+func (r *mutationResolver) CreateProduct(ctx context.Context, input model.NewProduct) (*model.Product, error) {
+	product, err := transform.LoadProduct(input)
+	if err != nil {
+		return nil, err
+	}
+	created, err := r.Shop.CreateProduct(product)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertProduct(created), nil
+}
+
+func (r *mutationResolver) UpdateProduct(ctx context.Context, input model.ProductUpdate) (*model.Product, error) {
+	update, err := transform.LoadProductUpdate(input)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := r.Shop.UpdateProduct(input.Sku, update)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertProduct(updated), nil
+}
+
+func (r *mutationResolver) Restock(ctx context.Context, sku string, count int) (*model.Product, error) {
+	restocked, err := r.Shop.Restock(sku, count)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertProduct(restocked), nil
+}
+
+func (r *mutationResolver) DiscontinueProduct(ctx context.Context, sku string) (*model.Product, error) {
+	discontinued, err := r.Shop.DiscontinueProduct(sku)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertProduct(discontinued), nil
+}
+
+func (r *mutationResolver) CreatePromotion(ctx context.Context, input model.PromotionInput) (*model.Promotion, error) {
+	promo, err := transform.LoadPromotion(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Shop.CreatePromotion(promo); err != nil {
+		return nil, err
+	}
+	return transform.ConvertPromotion(promo), nil
+}
+
+func (r *mutationResolver) UpdatePromotion(ctx context.Context, sku string, input model.PromotionInput) (*model.Promotion, error) {
+	promo, err := transform.LoadPromotion(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Shop.UpdatePromotion(sku, promo); err != nil {
+		return nil, err
+	}
+	return transform.ConvertPromotion(promo), nil
+}
+
+func (r *mutationResolver) SetPromotionEnabled(ctx context.Context, sku string, enabled bool) (*model.Promotion, error) {
+	promo, err := r.Shop.EnablePromotion(sku, enabled)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertPromotion(promo), nil
+}
+
+func (r *mutationResolver) DeletePromotion(ctx context.Context, sku string) (*model.Promotion, error) {
+	promo, err := r.Shop.DeletePromotion(sku)
+	if err != nil {
+		return nil, err
+	}
+	return transform.ConvertPromotion(promo), nil
+}
+
 func (r *queryResolver) Cart(ctx context.Context, input *string) (*model.Cart, error) {
 	cartUUID := uuid.New()
 	var err error
@@ -74,12 +231,68 @@ func (r *queryResolver) Cart(ctx context.Context, input *string) (*model.Cart, e
 			return nil, errors.New("invalid Cart ID")
 		}
 	}
-	_, cart := store.RetrieveCart(&cartUUID)
+	_, cart := r.Shop.RetrieveCart(&cartUUID)
 	return transform.RefreshCart(cartUUID.String(), cart)
 }
 
-func (r *queryResolver) Products(ctx context.Context) ([]*model.Product, error) {
-	return transform.FilterInventory(), nil
+func (r *queryResolver) Products(ctx context.Context, filter *model.ProductFilter, sort *model.ProductSort, first *int, after *string) (*model.ProductConnection, error) {
+	return transform.SearchProducts(r.Shop, filter, sort, first, after)
+}
+
+func (r *queryResolver) Product(ctx context.Context, sku string) (*model.Product, error) {
+	return transform.ListedProduct(r.Shop, sku), nil
+}
+
+func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, error) {
+	orderUUID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("invalid Order ID")
+	}
+	order, ok := r.Shop.GetOrder(orderUUID)
+	if !ok {
+		return nil, nil
+	}
+	return transform.ConvertOrder(order), nil
+}
+
+func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
+	outOrders := make([]*model.Order, 0)
+	for _, order := range r.Shop.GetOrders() {
+		outOrders = append(outOrders, transform.ConvertOrder(order))
+	}
+	return outOrders, nil
+}
+
+func (r *queryResolver) AdminInventory(ctx context.Context) ([]*model.Product, error) {
+	return transform.AdminInventory(r.Shop), nil
+}
+
+func (r *queryResolver) Promotions(ctx context.Context) ([]*model.Promotion, error) {
+	return transform.ConvertPromotions(r.Shop.ActivePromotions()), nil
+}
+
+func (r *queryResolver) AdminPromotions(ctx context.Context) ([]*model.Promotion, error) {
+	return transform.ConvertPromotions(r.Shop.Promotions()), nil
+}
+
+func (r *queryResolver) ExportPromotions(ctx context.Context) (string, error) {
+	out, err := config.ExportPromotions(r.Shop.Promotions())
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (r *subscriptionResolver) CartEvents(ctx context.Context, cartID string) (<-chan *model.CartEvent, error) {
+	cartUUID, err := uuid.Parse(cartID)
+	if err != nil {
+		return nil, errors.New("invalid Cart ID")
+	}
+	if _, exists := r.Shop.ExistingCart(cartUUID); !exists {
+		return nil, errors.New("cart does not exist")
+	}
+	events, unsubscribe := r.Shop.SubscribeCartEvents(cartUUID)
+	return transform.StreamCartEvents(ctx, events, unsubscribe), nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
@@ -88,5 +301,9 @@ func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResol
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,380 @@
+package graph_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/graph"
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+)
+
+const stressWorkers = 32
+const stressRounds = 20
+
+func setupStressShop(t *testing.T) (*graph.Resolver, map[string]int) {
+	stock := []*store.Product{
+		{
+			SKU:   "A1234",
+			Name:  "Carrot",
+			Price: money.MustParse("1.1"),
+			Count: 100,
+		},
+		{
+			SKU:   "B1234",
+			Name:  "Stick",
+			Price: money.MustParse("0.1"),
+			Count: 50,
+		},
+	}
+	initialCounts := make(map[string]int)
+	for _, p := range stock {
+		initialCounts[p.SKU] = p.Count
+	}
+	shop := store.NewMemoryShop()
+	if err := shop.StockShop(stock); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A discount",
+			SKU:      "DISCOUNT",
+			Category: "discount",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 2,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".1"),
+			},
+		},
+	})
+	return &graph.Resolver{Shop: shop}, initialCounts
+}
+
+// checkStockConserved verifies that every unit of stock is either still in the inventory or in exactly one cart
+func checkStockConserved(t *testing.T, resolver *graph.Resolver, initialCounts map[string]int, cartIds []string) {
+	counted := make(map[string]int)
+	for sku, p := range resolver.Shop.GetInventory() {
+		counted[sku] += p.Count
+	}
+	for _, id := range cartIds {
+		cartId := id
+		cart, err := resolver.Query().Cart(context.Background(), &cartId)
+		if err != nil {
+			t.Fatalf("Could not retrieve cart %s: %+v", cartId, err)
+		}
+		for _, p := range cart.AddedItems {
+			counted[p.Sku] += *p.Count
+		}
+	}
+	for sku, expected := range initialCounts {
+		if counted[sku] != expected {
+			t.Errorf("Stock for %s not conserved. Expected %d, found %d.", sku, expected, counted[sku])
+		}
+	}
+}
+
+func TestResolvers_ParallelAddProduct(t *testing.T) {
+	t.Parallel()
+	resolver, initialCounts := setupStressShop(t)
+	sharedCart := uuid.New().String()
+	cartIds := []string{sharedCart}
+	for i := 0; i < stressWorkers; i++ {
+		cartIds = append(cartIds, uuid.New().String())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressWorkers; i++ {
+		wg.Add(1)
+		go func(ownCart string) {
+			defer wg.Done()
+			for r := 0; r < stressRounds; r++ {
+				cartId := ownCart
+				if r%2 == 0 {
+					cartId = sharedCart
+				}
+				sku := "A1234"
+				if r%3 == 0 {
+					sku = "B1234"
+				}
+				// errors are expected once stock runs out
+				_, _ = resolver.Mutation().AddProduct(context.Background(), model.AdditionalItem{
+					CartID: &cartId,
+					Item: &model.NewItem{
+						Product: sku,
+						Count:   1,
+					},
+				})
+				if _, err := resolver.Query().Cart(context.Background(), &cartId); err != nil {
+					t.Errorf("Could not retrieve cart %s: %+v", cartId, err)
+				}
+				if _, err := resolver.Query().Products(context.Background(), nil, nil, nil, nil); err != nil {
+					t.Errorf("Could not retrieve products: %+v", err)
+				}
+			}
+		}(cartIds[i+1])
+	}
+	wg.Wait()
+
+	checkStockConserved(t, resolver, initialCounts, cartIds)
+	for sku, p := range resolver.Shop.GetInventory() {
+		if p.Count != 0 {
+			t.Errorf("Expected stock for %s to be exhausted, found %d left.", sku, p.Count)
+		}
+	}
+}
+
+func TestResolvers_ParallelUpdateCart(t *testing.T) {
+	t.Parallel()
+	resolver, initialCounts := setupStressShop(t)
+	cartIds := make([]string, 0)
+	for i := 0; i < stressWorkers/4; i++ {
+		cartIds = append(cartIds, uuid.New().String())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressWorkers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for r := 0; r < stressRounds; r++ {
+				cartId := cartIds[(worker+r)%len(cartIds)]
+				_, err := resolver.Mutation().UpdateCart(context.Background(), model.NewCart{
+					CartID: &cartId,
+					Products: []*model.NewItem{
+						{
+							Product: "A1234",
+							Count:   (worker + r) % 20,
+						},
+						{
+							Product: "B1234",
+							Count:   (worker * r) % 10,
+						},
+					},
+				})
+				if err != nil {
+					t.Errorf("Updating cart %s failed: %+v", cartId, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	checkStockConserved(t, resolver, initialCounts, cartIds)
+}
+
+func TestResolvers_ParallelRegisterPromotions(t *testing.T) {
+	t.Parallel()
+	resolver, _ := setupStressShop(t)
+	cartId := uuid.New().String()
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressWorkers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for r := 0; r < stressRounds; r++ {
+				if worker%4 == 0 {
+					resolver.Shop.RegisterPromotions(nil)
+					continue
+				}
+				if _, err := resolver.Query().Cart(context.Background(), &cartId); err != nil {
+					t.Errorf("Could not retrieve cart %s: %+v", cartId, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResolvers_Products(t *testing.T) {
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	stock := []*store.Product{
+		{SKU: "C1234", Name: "Apple", Price: money.MustParse("0.5"), Count: 0, Categories: []string{"Food/Fruit"}},
+		{SKU: "D1234", Name: "Banana", Price: money.MustParse("0.3"), Count: 4, Categories: []string{"Food/Fruit"}},
+		{SKU: "E1234", Name: "Hammer", Price: money.MustParse("12"), Count: 1, Categories: []string{"Tools"}},
+	}
+	for _, p := range stock {
+		if _, err := resolver.Shop.CreateProduct(p); err != nil {
+			t.Fatalf("Test setup failed: %+v", err)
+		}
+	}
+	skus := func(connection *model.ProductConnection) []string {
+		found := make([]string, 0)
+		for _, edge := range connection.Edges {
+			found = append(found, edge.Node.Sku)
+		}
+		return found
+	}
+
+	descending := true
+	byPrice := &model.ProductSort{Field: model.ProductSortFieldPrice, Descending: &descending}
+	first := 2
+	page, err := resolver.Query().Products(ctx, nil, byPrice, &first, nil)
+	if err != nil {
+		t.Fatalf("Could not retrieve products: %+v", err)
+	}
+	if expected := []string{"E1234", "A1234"}; !reflect.DeepEqual(skus(page), expected) || !page.PageInfo.HasNextPage || page.TotalCount != 5 {
+		t.Errorf("Unexpected first page. Expected %+v, got %+v (%+v).", expected, skus(page), page.PageInfo)
+	}
+	page, err = resolver.Query().Products(ctx, nil, byPrice, &first, page.PageInfo.EndCursor)
+	if err != nil {
+		t.Fatalf("Could not retrieve products: %+v", err)
+	}
+	if expected := []string{"C1234", "D1234"}; !reflect.DeepEqual(skus(page), expected) || !page.PageInfo.HasPreviousPage {
+		t.Errorf("Unexpected second page. Expected %+v, got %+v (%+v).", expected, skus(page), page.PageInfo)
+	}
+
+	search, category, inStock := "AN", "food", true
+	maxPrice := money.MustParse("1")
+	filters := map[*model.ProductFilter][]string{
+		{Search: &search}:                        {"D1234"},
+		{Category: &category}:                    {"C1234", "D1234"},
+		{Category: &category, InStock: &inStock}: {"D1234"},
+		{MaxPrice: &maxPrice}:                    {"B1234", "C1234", "D1234"},
+	}
+	for filter, expected := range filters {
+		found, err := resolver.Query().Products(ctx, filter, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Could not retrieve products: %+v", err)
+		}
+		if !reflect.DeepEqual(skus(found), expected) {
+			t.Errorf("Unexpected products for filter %+v. Expected %+v, got %+v.", filter, expected, skus(found))
+		}
+	}
+	euros := money.MustParse("1 EUR")
+	if _, err := resolver.Query().Products(ctx, &model.ProductFilter{MinPrice: &euros}, nil, nil, nil); err == nil {
+		t.Error("Filtering by a price in another currency did not throw an error.")
+	}
+	invalid := "not a cursor"
+	if _, err := resolver.Query().Products(ctx, nil, nil, nil, &invalid); err == nil {
+		t.Error("Paging after an invalid cursor did not throw an error.")
+	}
+}
+
+func TestResolvers_CartLines(t *testing.T) {
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	cartId := uuid.New().String()
+	for _, sku := range []string{"B1234", "A1234", "A1234"} {
+		_, err := resolver.Mutation().AddProduct(ctx, model.AdditionalItem{
+			CartID: &cartId,
+			Item:   &model.NewItem{Product: sku, Count: 1},
+		})
+		if err != nil {
+			t.Fatalf("Adding to cart failed: %+v", err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		cart, err := resolver.Query().Cart(ctx, &cartId)
+		if err != nil {
+			t.Fatalf("Could not retrieve cart %s: %+v", cartId, err)
+		}
+		if len(cart.Lines) != 2 || cart.Lines[0].ID != "1" || cart.Lines[0].Product.Sku != "B1234" || cart.Lines[1].Product.Sku != "A1234" {
+			t.Fatalf("Unexpected cart lines: %+v", cart.Lines)
+		}
+		if cart.AddedItems[0].Sku != "B1234" || cart.AddedItems[1].Sku != "A1234" {
+			t.Fatalf("Added items not in the order of the lines: %+v", cart.AddedItems)
+		}
+		if len(cart.PromotionLines) != 1 || cart.PromotionLines[0].ID != "DISCOUNT" {
+			t.Fatalf("Unexpected promotion lines: %+v", cart.PromotionLines)
+		}
+	}
+}
+
+func TestResolvers_ExpiredCart(t *testing.T) {
+	resolver, initialCounts := setupStressShop(t)
+	ctx := context.Background()
+	if err := resolver.Shop.SetCartTTL(50 * time.Millisecond); err != nil {
+		t.Fatalf("Setting cart TTL failed: %+v", err)
+	}
+	cartId := uuid.New().String()
+	_, err := resolver.Mutation().AddProduct(ctx, model.AdditionalItem{
+		CartID: &cartId,
+		Item:   &model.NewItem{Product: "A1234", Count: 1},
+	})
+	if err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := resolver.Mutation().RemoveProduct(ctx, cartId, "A1234", 1); err == nil || err.Error() != "cart does not exist" {
+		t.Errorf("Removing from an expired cart did not fail as expected: %+v", err)
+	}
+	if _, err := resolver.Mutation().ClearCart(ctx, cartId); err == nil {
+		t.Error("Clearing an expired cart did not throw an error.")
+	}
+	if _, err := resolver.Mutation().ApplyCoupon(ctx, cartId, "SAVE10"); err == nil {
+		t.Error("Applying a coupon to an expired cart did not throw an error.")
+	}
+	if count := resolver.Shop.GetInventory()["A1234"].Count; count != initialCounts["A1234"] {
+		t.Errorf("Stock not released from expired cart. Expected %d, got %d.", initialCounts["A1234"], count)
+	}
+}
+
+func TestResolvers_Availability(t *testing.T) {
+	resolver, _ := setupStressShop(t)
+	ctx := context.Background()
+	stock := []*store.Product{
+		{SKU: "C1234", Name: "Apple", Price: money.MustParse("0.5"), Count: 3, LowStock: 5},
+		{SKU: "D1234", Name: "Banana", Price: money.MustParse("0.3"), Count: 0, Backorder: true},
+		{SKU: "E1234", Name: "Cherry", Price: money.MustParse("0.2"), Count: 0},
+		{SKU: "F1234", Name: "Fig", Price: money.MustParse("0.4")},
+		{SKU: "F1234-D", Parent: "F1234", Count: 0, Attributes: map[string]string{"kind": "dried"}},
+		{SKU: "F1234-F", Parent: "F1234", Count: 1, LowStock: 2, Attributes: map[string]string{"kind": "fresh"}},
+	}
+	for _, p := range stock {
+		if _, err := resolver.Shop.CreateProduct(p); err != nil {
+			t.Fatalf("Test setup failed: %+v", err)
+		}
+	}
+	found, err := resolver.Query().Products(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Could not retrieve products: %+v", err)
+	}
+	expected := map[string]model.Availability{
+		"A1234": model.AvailabilityInStock,
+		"B1234": model.AvailabilityInStock,
+		"C1234": model.AvailabilityLowStock,
+		"D1234": model.AvailabilityBackorder,
+		"E1234": model.AvailabilityOutOfStock,
+		"F1234": model.AvailabilityLowStock,
+	}
+	for _, edge := range found.Edges {
+		if edge.Node.Availability == nil || *edge.Node.Availability != expected[edge.Node.Sku] {
+			t.Errorf("Unexpected availability for %s. Expected %s, got %v.", edge.Node.Sku, expected[edge.Node.Sku], edge.Node.Availability)
+		}
+	}
+
+	cartId := uuid.New().String()
+	_, err = resolver.Mutation().AddProduct(ctx, model.AdditionalItem{
+		CartID: &cartId,
+		Item:   &model.NewItem{Product: "D1234", Count: 2},
+	})
+	if err != nil {
+		t.Fatalf("Adding backordered product to cart failed: %+v", err)
+	}
+	cart, err := resolver.Query().Cart(ctx, &cartId)
+	if err != nil {
+		t.Fatalf("Could not retrieve cart %s: %+v", cartId, err)
+	}
+	if len(cart.Lines) != 1 || *cart.Lines[0].Product.Count != 2 {
+		t.Fatalf("Unexpected cart lines: %+v", cart.Lines)
+	}
+	if availability := cart.Lines[0].Product.Availability; availability == nil || *availability != model.AvailabilityBackorder {
+		t.Errorf("Unexpected availability on cart line. Expected %s, got %v.", model.AvailabilityBackorder, availability)
+	}
+	order, err := resolver.Mutation().Checkout(ctx, cartId)
+	if err != nil {
+		t.Fatalf("Checkout failed: %+v", err)
+	}
+	if len(order.Items) != 1 || order.Items[0].Availability != nil {
+		t.Errorf("Ordered item has an availability: %+v", order.Items)
+	}
+}
@@ -0,0 +1,302 @@
+package money
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts which do not specify a currency
+const DefaultCurrency = "USD"
+
+// minorUnitExponents lists currencies which do not have two decimal places
+var minorUnitExponents = map[string]int{
+	"BHD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// RateScale is the number of rate units making up 100%. Rates are stored in basis points.
+const RateScale = 10000
+
+// Money is an exact amount of money in the minor unit of its currency (e.g. cents).
+// The zero value is zero in any currency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// Rate is a fraction such as a percentage discount in basis points (1/100th of a percent)
+type Rate int64
+
+// New creates an amount of money from minor units
+func New(amount int64, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: currency,
+	}
+}
+
+// exponent returns the number of decimal places of a currency
+func exponent(currency string) int {
+	if exp, ok := minorUnitExponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// parseDecimal parses a decimal number into an integer scaled by 10^places. It rejects numbers with more
+// decimal places rather than rounding them.
+func parseDecimal(in string, places int) (int64, error) {
+	in = strings.TrimSpace(in)
+	negative := strings.HasPrefix(in, "-")
+	in = strings.TrimPrefix(strings.TrimPrefix(in, "-"), "+")
+	parts := strings.SplitN(in, ".", 2)
+	whole, fraction := parts[0], ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf(`invalid decimal "%s"`, in)
+	}
+	if len(strings.TrimRight(fraction, "0")) > places {
+		return 0, fmt.Errorf(`decimal "%s" has more than %d decimal places`, in, places)
+	}
+	if len(fraction) > places {
+		fraction = fraction[:places]
+	}
+	fraction += strings.Repeat("0", places-len(fraction))
+	digits := whole + fraction
+	for _, d := range digits {
+		if d < '0' || d > '9' {
+			return 0, fmt.Errorf(`invalid decimal "%s"`, in)
+		}
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf(`invalid decimal "%s": %w`, in, err)
+	}
+	if negative {
+		value = -value
+	}
+	return value, nil
+}
+
+// formatDecimal formats an integer scaled by 10^places as a decimal number
+func formatDecimal(value int64, places int) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	digits := strconv.FormatInt(value, 10)
+	if places == 0 {
+		return sign + digits
+	}
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
+
+// Parse parses an amount such as "49.99" or "49.99 EUR". Amounts without a currency are in DefaultCurrency.
+func Parse(in string) (Money, error) {
+	fields := strings.Fields(in)
+	currency := DefaultCurrency
+	switch len(fields) {
+	case 1:
+	case 2:
+		currency = strings.ToUpper(fields[1])
+	default:
+		return Money{}, fmt.Errorf(`invalid amount "%s"`, in)
+	}
+	amount, err := parseDecimal(fields[0], exponent(currency))
+	if err != nil {
+		return Money{}, err
+	}
+	return New(amount, currency), nil
+}
+
+// MustParse parses an amount and panics if it is invalid
+func MustParse(in string) Money {
+	m, err := Parse(in)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// IsZero checks if the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Zero returns zero in the same currency
+func (m Money) Zero() Money {
+	return New(0, m.Currency)
+}
+
+// Neg negates the amount
+func (m Money) Neg() Money {
+	return New(-m.Amount, m.Currency)
+}
+
+// Mul multiplies the amount by a count
+func (m Money) Mul(count int64) Money {
+	return New(m.Amount*count, m.Currency)
+}
+
+// sameCurrency determines the currency of the result of combining two amounts. Zero amounts without a currency
+// take on the other amount's currency.
+func (m Money) sameCurrency(other Money) string {
+	switch {
+	case m.Currency == other.Currency:
+		return m.Currency
+	case m.Currency == "" && m.IsZero():
+		return other.Currency
+	case other.Currency == "" && other.IsZero():
+		return m.Currency
+	}
+	panic(fmt.Sprintf(`cannot combine amounts in %s and %s`, m.Currency, other.Currency))
+}
+
+// Add adds two amounts in the same currency
+func (m Money) Add(other Money) Money {
+	return New(m.Amount+other.Amount, m.sameCurrency(other))
+}
+
+// Sub subtracts an amount in the same currency
+func (m Money) Sub(other Money) Money {
+	return New(m.Amount-other.Amount, m.sameCurrency(other))
+}
+
+// Cmp compares two amounts in the same currency, returning -1, 0 or 1
+func (m Money) Cmp(other Money) int {
+	m.sameCurrency(other)
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Percent applies a rate to the amount. The result is rounded to the nearest minor unit with halves rounded
+// away from zero, so 10% of 0.05 is 0.01 and 10% of -0.05 is -0.01.
+func (m Money) Percent(rate Rate) Money {
+	product := m.Amount * int64(rate)
+	result := product / RateScale
+	remainder := product % RateScale
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder*2 >= RateScale {
+		if product < 0 {
+			result--
+		} else {
+			result++
+		}
+	}
+	return New(result, m.Currency)
+}
+
+// Decimal formats the amount as a decimal number without the currency
+func (m Money) Decimal() string {
+	return formatDecimal(m.Amount, exponent(m.Currency))
+}
+
+// String formats the amount with its currency, e.g. "49.99 USD"
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// UnmarshalYAML reads an amount such as 49.99 or "49.99 EUR" from YAML
+func (m *Money) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var in string
+	if err := unmarshal(&in); err != nil {
+		return err
+	}
+	parsed, err := Parse(in)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MarshalYAML writes the amount to YAML with its currency, e.g. "49.99 USD"
+func (m Money) MarshalYAML() (interface{}, error) {
+	return m.String(), nil
+}
+
+// MarshalGQL writes the amount as a GraphQL string such as "49.99 USD"
+func (m Money) MarshalGQL(w io.Writer) {
+	_, _ = io.WriteString(w, strconv.Quote(m.String()))
+}
+
+// UnmarshalGQL reads an amount from a GraphQL string such as "49.99" or "49.99 USD"
+func (m *Money) UnmarshalGQL(v interface{}) error {
+	in, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(`money must be a string, got %T`, v)
+	}
+	parsed, err := Parse(in)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ParseRate parses a fraction such as ".1" for 10%
+func ParseRate(in string) (Rate, error) {
+	value, err := parseDecimal(in, 4)
+	if err != nil {
+		return 0, err
+	}
+	return Rate(value), nil
+}
+
+// MustParseRate parses a rate and panics if it is invalid
+func MustParseRate(in string) Rate {
+	r, err := ParseRate(in)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// String formats the rate as a fraction, e.g. "0.1000"
+func (r Rate) String() string {
+	return formatDecimal(int64(r), 4)
+}
+
+// UnmarshalYAML reads a rate such as .1 from YAML
+func (r *Rate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var in string
+	if err := unmarshal(&in); err != nil {
+		return err
+	}
+	parsed, err := ParseRate(in)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// MarshalYAML writes the rate to YAML as a fraction
+func (r Rate) MarshalYAML() (interface{}, error) {
+	return r.String(), nil
+}
@@ -0,0 +1,115 @@
+package money_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	valid := map[string]money.Money{
+		"49.99":     money.New(4999, "USD"),
+		"30.":       money.New(3000, "USD"),
+		".5":        money.New(50, "USD"),
+		"0":         money.New(0, "USD"),
+		"-1.10":     money.New(-110, "USD"),
+		"12.50 eur": money.New(1250, "EUR"),
+		"1200 JPY":  money.New(1200, "JPY"),
+		"1.234 KWD": money.New(1234, "KWD"),
+		"5.000":     money.New(500, "USD"),
+	}
+	for in, expected := range valid {
+		parsed, err := money.Parse(in)
+		if err != nil {
+			t.Errorf("Parsing %s failed: %+v", in, err)
+		} else if parsed != expected {
+			t.Errorf("Parsed %s incorrectly. Expected %+v, got %+v.", in, expected, parsed)
+		}
+	}
+	for _, in := range []string{"", "abc", "1.999", "1.5 JPY", "1 2 3", ".", "1e3"} {
+		if _, err := money.Parse(in); err == nil {
+			t.Errorf("Parsing invalid amount %s did not throw an error.", in)
+		}
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	cases := map[string]money.Money{
+		"49.99 USD": money.New(4999, "USD"),
+		"0.05 USD":  money.New(5, "USD"),
+		"-0.05 USD": money.New(-5, "USD"),
+		"1200 JPY":  money.New(1200, "JPY"),
+		"0.00":      {},
+	}
+	for expected, m := range cases {
+		if m.String() != expected {
+			t.Errorf("Incorrect formatting. Expected %s, got %s.", expected, m.String())
+		}
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	price := money.MustParse("49.99")
+	total := money.Money{}
+	for i := 0; i < 3; i++ {
+		total = total.Add(price)
+	}
+	if total != money.MustParse("149.97") {
+		t.Errorf("Incorrect total. Expected 149.97 USD, got %s.", total)
+	}
+	if price.Mul(3) != total {
+		t.Errorf("Incorrect product. Expected %s, got %s.", total, price.Mul(3))
+	}
+	if total.Sub(price.Mul(2)) != price {
+		t.Errorf("Incorrect difference. Expected %s, got %s.", price, total.Sub(price.Mul(2)))
+	}
+	if price.Neg().Cmp(price) != -1 || price.Cmp(price) != 0 || price.Cmp(price.Neg()) != 1 {
+		t.Error("Incorrect comparison.")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Adding amounts in different currencies did not panic.")
+		}
+	}()
+	price.Add(money.MustParse("1 EUR"))
+}
+
+func TestMoney_Percent(t *testing.T) {
+	cases := []struct {
+		amount   string
+		rate     string
+		expected string
+	}{
+		{"109.50", ".1", "10.95"},
+		{"49.99", ".1", "5.00"},
+		{"0.05", ".1", "0.01"},
+		{"-0.05", ".1", "-0.01"},
+		{"0.04", ".1", "0.00"},
+		{"5399.99", ".125", "675.00"},
+		{"10", "1", "10.00"},
+	}
+	for _, c := range cases {
+		result := money.MustParse(c.amount).Percent(money.MustParseRate(c.rate))
+		if result != money.MustParse(c.expected) {
+			t.Errorf("Incorrect result for %s of %s. Expected %s, got %s.", c.rate, c.amount, c.expected, result)
+		}
+	}
+}
+
+func TestMoney_UnmarshalYAML(t *testing.T) {
+	var in struct {
+		Price    money.Money
+		Foreign  money.Money
+		Discount money.Rate
+	}
+	err := yaml.Unmarshal([]byte("price: 30.\nforeign: 12.5 EUR\ndiscount: .1\n"), &in)
+	if err != nil {
+		t.Fatalf("Unmarshalling failed: %+v", err)
+	}
+	if in.Price != money.New(3000, "USD") || in.Foreign != money.New(1250, "EUR") || in.Discount != 1000 {
+		t.Errorf("Unmarshalled incorrectly: %+v", in)
+	}
+	if err := yaml.Unmarshal([]byte("price: 1.999\n"), &in); err == nil {
+		t.Error("Unmarshalling an overly precise amount did not throw an error.")
+	}
+}
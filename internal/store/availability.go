@@ -0,0 +1,31 @@
+package store
+
+// Availability tells shoppers whether a product can be bought without revealing its stock level. Better
+// availabilities are greater.
+type Availability int
+
+const (
+	// OutOfStock products cannot be bought
+	OutOfStock Availability = iota
+	// OnBackorder products are out of stock but can be bought and ship once restocked
+	OnBackorder
+	// LowStock products are in stock at or below their low-stock threshold
+	LowStock
+	// InStock products are in stock above their low-stock threshold
+	InStock
+)
+
+// Availability works out how available a product in the inventory is
+func (p *Product) Availability() Availability {
+	switch {
+	case p.Discontinued:
+		return OutOfStock
+	case p.Count > p.LowStock:
+		return InStock
+	case p.Count > 0:
+		return LowStock
+	case p.Backorder:
+		return OnBackorder
+	}
+	return OutOfStock
+}
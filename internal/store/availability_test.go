@@ -0,0 +1,49 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"testing"
+)
+
+func TestProduct_Availability(t *testing.T) {
+	products := map[*store.Product]store.Availability{
+		{Count: 6, LowStock: 5}:                         store.InStock,
+		{Count: 5, LowStock: 5}:                         store.LowStock,
+		{Count: 1}:                                      store.InStock,
+		{Count: 0}:                                      store.OutOfStock,
+		{Count: 0, Backorder: true}:                     store.OnBackorder,
+		{Count: -2, Backorder: true}:                    store.OnBackorder,
+		{Count: 10, Discontinued: true}:                 store.OutOfStock,
+		{Count: 0, Backorder: true, Discontinued: true}: store.OutOfStock,
+	}
+	for p, expected := range products {
+		if actual := p.Availability(); actual != expected {
+			t.Errorf("Unexpected availability for %+v. Expected %d, got %d.", p, expected, actual)
+		}
+	}
+}
+
+func TestClaimInventory_Backorder(t *testing.T) {
+	shop := store.NewMemoryShop()
+	err := shop.StockShop([]*store.Product{
+		{SKU: "A1234", Name: "Carrot", Price: money.MustParse("1.1"), Count: 1, Backorder: true},
+		{SKU: "B1234", Name: "Stick", Price: money.MustParse("0.1"), Count: 1},
+	})
+	if err != nil {
+		t.Fatalf("Stocking shop failed: %+v", err)
+	}
+	claimed, err := shop.ClaimInventory(store.Product{SKU: "A1234", Count: 3})
+	if err != nil {
+		t.Fatalf("Failed to claim backordered stock: %+v", err)
+	}
+	if claimed.Count != 3 {
+		t.Errorf("Backordered claim capped. Expected 3, got %d.", claimed.Count)
+	}
+	if p := shop.GetInventory()["A1234"]; p.Count != -2 || p.Availability() != store.OnBackorder {
+		t.Errorf("Unexpected backordered product: %+v", p)
+	}
+	if claimed, err := shop.ClaimInventory(store.Product{SKU: "B1234", Count: 3}); err == nil || claimed.Count != 1 {
+		t.Errorf("Claim beyond stock not capped. Expected 1, got %+v.", claimed)
+	}
+}
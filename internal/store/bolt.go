@@ -0,0 +1,326 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+var inventoryBucket = []byte("inventory")
+var promotionsBucket = []byte("promotions")
+var cartsBucket = []byte("carts")
+var couponsBucket = []byte("coupons")
+var ordersBucket = []byte("orders")
+
+// promotionsKey holds the promotions as one list to preserve their order
+var promotionsKey = []byte("all")
+
+const boltOpenTimeout = 5 * time.Second
+
+// BoltDB keeps the shop's state in an embedded bbolt database file so it survives restarts
+type BoltDB struct {
+	db *bolt.DB
+}
+
+// BoltInventory is an InventoryRepository backed by a BoltDB
+type BoltInventory struct {
+	db *bolt.DB
+}
+
+// BoltPromotions is a PromotionRepository backed by a BoltDB. Promotions are cached as they are read for every cart.
+type BoltPromotions struct {
+	db         *bolt.DB
+	lock       sync.RWMutex
+	promotions []*Promotion
+}
+
+// BoltCarts is a CartRepository backed by a BoltDB
+type BoltCarts struct {
+	db *bolt.DB
+}
+
+// BoltOrders is an OrderRepository backed by a BoltDB
+type BoltOrders struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates a database file
+func OpenBolt(path string) (*BoltDB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{inventoryBucket, promotionsBucket, cartsBucket, couponsBucket, ordersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialise database: %w", err)
+	}
+	return &BoltDB{db: db}, nil
+}
+
+// Close closes the database file
+func (b *BoltDB) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltDB) Inventory() *BoltInventory {
+	return &BoltInventory{db: b.db}
+}
+
+func (b *BoltDB) Promotions() (*BoltPromotions, error) {
+	promos := &BoltPromotions{db: b.db}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(promotionsBucket).Get(promotionsKey)
+		if stored == nil {
+			return nil
+		}
+		return json.Unmarshal(stored, &promos.promotions)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load promotions: %w", err)
+	}
+	return promos, nil
+}
+
+func (b *BoltDB) Carts() *BoltCarts {
+	return &BoltCarts{db: b.db}
+}
+
+func (b *BoltDB) Orders() *BoltOrders {
+	return &BoltOrders{db: b.db}
+}
+
+func (i *BoltInventory) Replace(stock []*Product) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		return replaceStock(tx, stock)
+	})
+}
+
+// replaceStock replaces the inventory within a transaction
+func replaceStock(tx *bolt.Tx, stock []*Product) error {
+	if err := tx.DeleteBucket(inventoryBucket); err != nil {
+		return err
+	}
+	bucket, err := tx.CreateBucket(inventoryBucket)
+	if err != nil {
+		return err
+	}
+	for _, p := range stock {
+		if err := putJSON(bucket, []byte(p.SKU), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *BoltInventory) Update(change func(products map[string]*Product) error) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		products, err := readStock(tx)
+		if err != nil {
+			return err
+		}
+		if err := change(products); err != nil {
+			return err
+		}
+		stock := make([]*Product, 0, len(products))
+		for _, p := range products {
+			stock = append(stock, p)
+		}
+		return replaceStock(tx, stock)
+	})
+}
+
+// update applies a change to a product in a single transaction which is rolled back if the change fails
+func (i *BoltInventory) update(sku string, change func(invProd *Product) error) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(inventoryBucket)
+		stored := bucket.Get([]byte(sku))
+		if stored == nil {
+			return fmt.Errorf(`SKU "%s" does not exist`, sku)
+		}
+		invProd := &Product{}
+		if err := json.Unmarshal(stored, invProd); err != nil {
+			return err
+		}
+		if err := change(invProd); err != nil {
+			return err
+		}
+		return putJSON(bucket, []byte(sku), invProd)
+	})
+}
+
+func (i *BoltInventory) Claim(product Product) (*Product, error) {
+	var claim *Product
+	var claimErr error
+	err := i.update(product.SKU, func(invProd *Product) error {
+		claim, claimErr = claimStock(invProd, product)
+		return nil // a partial claim still needs committing
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claim, claimErr
+}
+
+func (i *BoltInventory) Release(product Product) error {
+	return i.update(product.SKU, func(invProd *Product) error {
+		invProd.Count += product.Count
+		return nil
+	})
+}
+
+func (i *BoltInventory) All() (map[string]*Product, error) {
+	var products map[string]*Product
+	err := i.db.View(func(tx *bolt.Tx) error {
+		var err error
+		products, err = readStock(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// readStock reads the inventory within a transaction
+func readStock(tx *bolt.Tx) (map[string]*Product, error) {
+	products := make(map[string]*Product, 0)
+	err := tx.Bucket(inventoryBucket).ForEach(func(k, v []byte) error {
+		p := &Product{}
+		if err := json.Unmarshal(v, p); err != nil {
+			return err
+		}
+		products[p.SKU] = p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (p *BoltPromotions) Replace(promos []*Promotion) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	err := p.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(promotionsBucket), promotionsKey, promos)
+	})
+	if err != nil {
+		return err
+	}
+	p.promotions = promos
+	return nil
+}
+
+func (p *BoltPromotions) All() ([]*Promotion, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.promotions, nil
+}
+
+// updateCodeUses changes the usage count of a coupon code in a single transaction
+func (p *BoltPromotions) updateCodeUses(code string, change func(uses int) (int, error)) error {
+	return p.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(couponsBucket)
+		uses := 0
+		if stored := bucket.Get([]byte(code)); stored != nil {
+			if err := json.Unmarshal(stored, &uses); err != nil {
+				return err
+			}
+		}
+		uses, err := change(uses)
+		if err != nil {
+			return err
+		}
+		return putJSON(bucket, []byte(code), uses)
+	})
+}
+
+func (p *BoltPromotions) ClaimCode(code string, limit int) error {
+	return p.updateCodeUses(code, func(uses int) (int, error) {
+		return claimCode(uses, limit)
+	})
+}
+
+func (p *BoltPromotions) ReleaseCode(code string) error {
+	return p.updateCodeUses(code, func(uses int) (int, error) {
+		return releaseCode(code, uses)
+	})
+}
+
+func (c *BoltCarts) Put(cartId uuid.UUID, cart *CartRecord) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(cartsBucket), []byte(cartId.String()), cart)
+	})
+}
+
+func (c *BoltCarts) Delete(cartId uuid.UUID) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(cartsBucket).Delete([]byte(cartId.String()))
+	})
+}
+
+func (c *BoltCarts) All() (map[uuid.UUID]*CartRecord, error) {
+	all := make(map[uuid.UUID]*CartRecord, 0)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(cartsBucket).ForEach(func(k, v []byte) error {
+			cartId, err := uuid.ParseBytes(k)
+			if err != nil {
+				return err
+			}
+			cart := &CartRecord{}
+			if err := json.Unmarshal(v, cart); err != nil {
+				return err
+			}
+			all[cartId] = cart
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+func (o *BoltOrders) Put(order *Order) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(ordersBucket), []byte(order.ID.String()), order)
+	})
+}
+
+func (o *BoltOrders) All() ([]*Order, error) {
+	all := make([]*Order, 0)
+	err := o.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(ordersBucket).ForEach(func(k, v []byte) error {
+			order := &Order{}
+			if err := json.Unmarshal(v, order); err != nil {
+				return err
+			}
+			all = append(all, order)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// putJSON stores a value as JSON
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, encoded)
+}
@@ -0,0 +1,205 @@
+package store_test
+
+import (
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openBoltShop(t *testing.T, path string) (*store.Shop, *store.BoltDB) {
+	db, err := store.OpenBolt(path)
+	if err != nil {
+		t.Fatalf("Opening database failed: %+v", err)
+	}
+	promotions, err := db.Promotions()
+	if err != nil {
+		t.Fatalf("Loading promotions failed: %+v", err)
+	}
+	shop, err := store.NewShop(db.Inventory(), promotions, db.Carts(), db.Orders(), store.SystemClock)
+	if err != nil {
+		t.Fatalf("Opening shop failed: %+v", err)
+	}
+	return shop, db
+}
+
+func TestNewShop_Bolt(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "shop.db")
+	shop, db := openBoltShop(t, dbFile)
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	promos := []*store.Promotion{
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+	}
+	if err := shop.RegisterPromotions(promos); err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	for _, p := range []*store.Product{{SKU: "B1234", Count: 1}, {SKU: "A1234", Count: 2}} {
+		if err := cart.Add(p); err != nil {
+			t.Fatalf("Adding to cart failed: %+v", err)
+		}
+	}
+	expectedCart, expectedPromo, errors := cart.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	expectedLines := cart.View().Lines
+	expectedInventory := shop.GetInventory()
+	if err := db.Close(); err != nil {
+		t.Fatalf("Closing database failed: %+v", err)
+	}
+
+	shop, db = openBoltShop(t, dbFile)
+	defer db.Close()
+	if !shop.CartExists(cartId) {
+		t.Fatal("Cart not restored from database.")
+	}
+	if inventory := shop.GetInventory(); !reflect.DeepEqual(inventory, expectedInventory) {
+		t.Errorf("Inventory not restored. Expected %+v, got %+v.", expectedInventory, inventory)
+	}
+	_, cart = shop.RetrieveCart(&cartId)
+	restoredCart, restoredPromo, errors := cart.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving restored cart failed: %+v", errors)
+	}
+	if !reflect.DeepEqual(restoredCart, expectedCart) {
+		t.Errorf("Cart contents not restored. Expected %+v, got %+v.", expectedCart, restoredCart)
+	}
+	if !reflect.DeepEqual(restoredPromo, expectedPromo) {
+		t.Errorf("Promotion items not restored. Expected %+v, got %+v.", expectedPromo, restoredPromo)
+	}
+	if lines := cart.View().Lines; !reflect.DeepEqual(lines, expectedLines) {
+		t.Errorf("Cart lines not restored. Expected %+v, got %+v.", expectedLines, lines)
+	}
+	if inventory := shop.GetInventory(); !reflect.DeepEqual(inventory, expectedInventory) {
+		t.Errorf("Restored cart claimed stock again. Expected %+v, got %+v.", expectedInventory, inventory)
+	}
+}
+
+func TestNewShop_BoltOrders(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "shop.db")
+	shop, db := openBoltShop(t, dbFile)
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	expected, err := shop.Checkout(cartId)
+	if err != nil {
+		t.Fatalf("Checkout failed: %+v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Closing database failed: %+v", err)
+	}
+
+	shop, db = openBoltShop(t, dbFile)
+	defer db.Close()
+	order, ok := shop.GetOrder(expected.ID)
+	if !ok {
+		t.Fatal("Order not restored from database.")
+	}
+	if !reflect.DeepEqual(order.Items, expected.Items) || order.Total != expected.Total || !order.Placed.Equal(expected.Placed) {
+		t.Errorf("Order not restored. Expected %+v, got %+v.", expected, order)
+	}
+}
+
+func TestBoltInventory_Claim(t *testing.T) {
+	db, err := store.OpenBolt(filepath.Join(t.TempDir(), "shop.db"))
+	if err != nil {
+		t.Fatalf("Opening database failed: %+v", err)
+	}
+	defer db.Close()
+	inventory := db.Inventory()
+	err = inventory.Replace([]*store.Product{
+		{
+			SKU:   "A1234",
+			Name:  "Carrot",
+			Price: money.MustParse("1.1"),
+			Count: 3,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Stocking inventory failed: %+v", err)
+	}
+	claim, err := inventory.Claim(store.Product{SKU: "A1234", Count: 5})
+	if err == nil || err.Error() != "not enough stock" {
+		t.Errorf("Did not get expected out of stock error: %+v", err)
+	}
+	if claim == nil || claim.Count != 3 || claim.Name != "Carrot" {
+		t.Errorf("Unexpected partial claim: %+v", claim)
+	}
+	if _, err := inventory.Claim(store.Product{SKU: "B1234", Count: 1}); err == nil {
+		t.Error("Claiming a non-existent SKU did not throw an error.")
+	}
+	if err := inventory.Release(store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Releasing stock failed: %+v", err)
+	}
+	all, err := inventory.All()
+	if err != nil {
+		t.Fatalf("Reading inventory failed: %+v", err)
+	}
+	if all["A1234"].Count != 2 {
+		t.Errorf("Unexpected stock. Expected 2, got %d.", all["A1234"].Count)
+	}
+}
+
+func TestBoltPromotions_ClaimCode(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "shop.db")
+	db, err := store.OpenBolt(dbFile)
+	if err != nil {
+		t.Fatalf("Opening database failed: %+v", err)
+	}
+	promotions, err := db.Promotions()
+	if err != nil {
+		t.Fatalf("Loading promotions failed: %+v", err)
+	}
+	if err := promotions.ClaimCode("SAVE5", 2); err != nil {
+		t.Fatalf("Claiming code failed: %+v", err)
+	}
+	if err := promotions.ReleaseCode("SAVE5"); err != nil {
+		t.Fatalf("Releasing code failed: %+v", err)
+	}
+	if err := promotions.ReleaseCode("SAVE5"); err == nil {
+		t.Error("Releasing an unused code did not throw an error.")
+	}
+	for i := 0; i < 2; i++ {
+		if err := promotions.ClaimCode("SAVE5", 2); err != nil {
+			t.Fatalf("Claiming code failed: %+v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Closing database failed: %+v", err)
+	}
+
+	db, err = store.OpenBolt(dbFile)
+	if err != nil {
+		t.Fatalf("Opening database failed: %+v", err)
+	}
+	defer db.Close()
+	if promotions, err = db.Promotions(); err != nil {
+		t.Fatalf("Loading promotions failed: %+v", err)
+	}
+	if err := promotions.ClaimCode("SAVE5", 2); err == nil {
+		t.Error("Code usage not restored from database.")
+	}
+}
@@ -1,70 +1,113 @@
 package store
 
 import (
+	"errors"
 	"fmt"
+	"github.com/golang/glog"
 	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/money"
+	"sync"
 	"time"
 )
 
+// Cart holds the items a shopper has claimed from the inventory. All access to its fields goes through lock.
 type Cart struct {
+	lock       sync.Mutex
+	shop       *Shop
+	id         uuid.UUID
 	contents   map[string]*Product
 	promoCache map[string]*Product
+	coupons    []string
 	expires    time.Time
+	released   bool
+	warned     bool
+	// lines orders the products in contents. nextLine is the number of the last line added.
+	lines    []LineRef
+	nextLine int
 }
 
-var carts map[uuid.UUID]*Cart
-
-func InitShop() {
-	carts = make(map[uuid.UUID]*Cart, 0)
-}
+var errCartExpired = errors.New("cart has expired")
 
 // Add adds a product to a cart with an item count
 func (c *Cart) Add(product *Product) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.persist()
+	if c.released {
+		return errCartExpired
+	}
+	c.touch(c.shop.clock.Now())
 	if c.contents == nil {
 		c.contents = make(map[string]*Product)
 	}
-	claims, err := ClaimInventory(*product)
-	if err != nil {
+	claims, err := c.shop.ClaimInventory(*product)
+	if claims == nil || claims.Count == 0 {
 		return err
 	}
+	// partial claims still go into the cart so that no stock is lost when running out
 	if inCart, ok := c.contents[product.SKU]; ok { // add new item
 		inCart.Count += claims.Count
 		c.contents[product.SKU] = inCart
 	} else { // add existing
 		c.contents[product.SKU] = claims
+		c.addLine(product.SKU)
 	}
 	return err
 }
 
 // Update replaces the cart contents with those submitted
 func (c *Cart) Update(products []*Product) []error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.persist()
+	if c.released {
+		return []error{errCartExpired}
+	}
+	c.touch(c.shop.clock.Now())
 	errors := make([]error, 0)
 	if c.contents == nil {
 		c.contents = make(map[string]*Product)
 	}
 	for _, p := range products {
-		var prev *Product
-		var ok bool
-		if prev, ok = c.contents[p.SKU]; ok {
-			p = &Product{
+		if p.Count < 0 {
+			errors = append(errors, fmt.Errorf(`invalid count %d for SKU "%s"`, p.Count, p.SKU))
+			continue
+		}
+		prev, ok := c.contents[p.SKU]
+		if !ok {
+			prev = &Product{
 				SKU:   p.SKU,
-				Name:  p.Name,
-				Price: p.Price,
-				Count: p.Count - prev.Count,
+				Count: 0,
 			}
+		}
+		if delta := p.Count - prev.Count; delta < 0 {
+			if err := c.shop.ReleaseInventory(Product{SKU: p.SKU, Count: -delta}); err != nil {
+				errors = append(errors, err)
+				continue
+			}
+			prev.Count = p.Count
 		} else {
-			prev = &Product{}
-			*prev = *p
-			prev.Count = 0
+			claim := *p
+			claim.Count = delta
+			actual, err := c.shop.ClaimInventory(claim)
+			if err != nil {
+				errors = append(errors, err)
+			}
+			if actual == nil {
+				continue
+			}
+			prev.Name = actual.Name
+			prev.Price = actual.Price
+			prev.Tiers = actual.Tiers
+			prev.Parent = actual.Parent
+			prev.Count += actual.Count
 		}
-		actual, err := ClaimInventory(*p)
-		if err != nil {
-			errors = append(errors, err)
+		if prev.Count == 0 {
+			delete(c.contents, p.SKU)
+		} else {
+			c.contents[p.SKU] = prev
+			c.addLine(p.SKU)
 		}
-		c.contents[p.SKU] = prev
-		c.contents[p.SKU].Name = actual.Name
-		c.contents[p.SKU].Price = actual.Price
-		c.contents[p.SKU].Count += actual.Count
 	}
 	if len(errors) == 0 {
 		errors = nil
@@ -72,67 +115,380 @@ func (c *Cart) Update(products []*Product) []error {
 	return errors
 }
 
-// Get retrieves the cart with promotions applied
+// CartView is a snapshot of a cart with promotions applied
+type CartView struct {
+	Items          map[string]*Product
+	PromotionItems map[string]*Product
+	// Lines lists the products in the cart in the order they were first added
+	Lines []*CartLine
+	// PromotionLines lists the promotion items in the order the promotions were chosen. Their IDs are the SKUs
+	// of the promotions and their availability is not set.
+	PromotionLines []*CartLine
+	// Skipped lists promotions the cart qualified for which lost out to other promotions
+	Skipped []*SkippedPromotion
+	// Applied explains the promotions applied to the cart in the order they were chosen
+	Applied []*PromotionExplanation
+	// Rejected explains why each other promotion was not applied in the order the promotions were registered
+	Rejected []*PromotionExplanation
+	Errors   []error
+}
+
+// Get retrieves a snapshot of the cart with promotions applied
 func (c *Cart) Get() (cartItems, promoItems map[string]*Product, errors []error) {
-	errors = make([]error, 0)
+	view := c.View()
+	return view.Items, view.PromotionItems, view.Errors
+}
+
+// View retrieves a snapshot of the cart with promotions applied and the promotions skipped in favour of others.
+// The cart is only stored again if applying promotions claimed or released stock.
+func (c *Cart) View() *CartView {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	claims := copyProducts(c.promoCache)
+	view := c.get()
+	if c.claimsChanged(claims) {
+		c.persist()
+	}
+	return view
+}
+
+// claimsChanged checks if the stock held for promotions differs from an earlier copy. The caller must hold the
+// cart's lock.
+func (c *Cart) claimsChanged(before map[string]*Product) bool {
+	if len(before) != len(c.promoCache) {
+		return true
+	}
+	for sku, claim := range c.promoCache {
+		if previous, ok := before[sku]; !ok || previous.Count != claim.Count {
+			return true
+		}
+	}
+	return false
+}
+
+// get applies promotions to the cart. The caller must hold the cart's lock.
+func (c *Cart) get() *CartView {
+	errors := make([]error, 0)
 	if c.promoCache == nil {
 		c.promoCache = make(map[string]*Product)
 	}
-	promoItems = make(map[string]*Product, 0)
-	for _, p := range c.contents {
-		for _, promo := range promotions {
-			inventoryClaim, extra, err := promo.Apply(p)
+	promoItems := make(map[string]*Product, 0)
+	promoLines := make([]*CartLine, 0)
+	claimed := make(map[string]bool)
+	promos, err := c.shop.promotions.All()
+	if err != nil {
+		errors = append(errors, fmt.Errorf(`internal error: %w`, err))
+	}
+	now := c.shop.clock.Now()
+	coupons, couponErrors := c.checkCoupons(promos, now)
+	errors = append(errors, couponErrors...)
+	// price tiers from the inventory come after the registered promotions
+	promos = append(append([]*Promotion{}, promos...), c.tierPromotions()...)
+	// rejections explains why promotions were not applied. Promotions without an entry did not qualify.
+	rejections := make(map[*Promotion]string)
+	// promotions outside their window are skipped, so stock claimed for them is released below
+	activePromos := make([]*Promotion, 0, len(promos))
+	for _, promo := range promos {
+		if promo.Disabled {
+			rejections[promo] = "disabled"
+			continue
+		}
+		if !promo.activeAt(now) {
+			rejections[promo] = "not running at this time"
+			continue
+		}
+		if promo.Code != "" && !coupons[normaliseCode(promo.Code)] {
+			rejections[promo] = fmt.Sprintf(`coupon code "%s" has not been applied`, normaliseCode(promo.Code))
+			continue
+		}
+		activePromos = append(activePromos, promo)
+	}
+	candidates, candidateErrors := c.promotionCandidates(activePromos)
+	errors = append(errors, candidateErrors...)
+	chosen, skipped := resolvePromotions(c.shop.PromotionStrategy(), candidates)
+	for _, s := range skipped {
+		rejections[s.promo] = s.reason
+	}
+	applied := make(map[*Promotion]bool, len(chosen))
+	explained := make([]*PromotionExplanation, 0, len(chosen))
+	for _, candidate := range chosen {
+		extra := candidate.item
+		// list is the list price of claimed items
+		var list money.Money
+		if candidate.claim != nil { // this promotion claims extra stock
+			claimed[candidate.claim.SKU] = true
+			actual, err := c.adjustPromoClaim(candidate.claim)
+			if isDiscontinued(err) { // the reward is no longer sold, which does not stop checkout
+				rejections[candidate.promo] = err.Error()
+				delete(claimed, candidate.claim.SKU) // release the reward stock below
+				continue
+			}
 			if err != nil {
-				errors = append(errors, fmt.Errorf(`internal error: %w`, err))
+				errors = append(errors, fmt.Errorf(`promotion could not be applied: %s`, err))
 			}
-			if inventoryClaim != nil { // this promotion claims extra stock
-				// check if we already have claimed items for promotion
-				var cached *Product
-				var ok bool
-				if cached, ok = c.promoCache[inventoryClaim.SKU]; ok {
-					inventoryClaim.Count = inventoryClaim.Count - cached.Count
-				} else {
-					cached = &Product{
-						Count: 0,
-					}
-				}
-				actual, err := ClaimInventory(*inventoryClaim)
-				if err != nil {
+			if actual == nil || actual.Count == 0 {
+				rejections[candidate.promo] = fmt.Sprintf(`SKU "%s" is out of stock`, candidate.claim.SKU)
+				continue
+			}
+			extra.Count = actual.Count
+			list = actual.Price
+			if candidate.promo.Category == "bxgy" {
+				if extra.Price, err = candidate.promo.rewardPrice(actual.Price); err != nil {
 					errors = append(errors, fmt.Errorf(`promotion could not be applied: %s`, err))
+					rejections[candidate.promo] = err.Error()
+					delete(claimed, candidate.claim.SKU) // release the reward stock below
+					continue
 				}
-				actual.Count += cached.Count
-				c.promoCache[actual.SKU] = actual
-				extra.Count = actual.Count
 			}
-			if extra != nil {
-				promoItems[extra.SKU] = extra
+		}
+		promoItems[extra.SKU] = extra
+		lineItem := *extra
+		promoLines = append(promoLines, &CartLine{ID: extra.SKU, Product: &lineItem})
+		applied[candidate.promo] = true
+		saving := list.Sub(extra.Price).Mul(int64(extra.Count))
+		explained = append(explained, candidate.promo.explain(c.contents, saving, ""))
+	}
+	rejected := make([]*PromotionExplanation, 0)
+	for _, promo := range promos {
+		if applied[promo] {
+			continue
+		}
+		reason, ok := rejections[promo]
+		if !ok {
+			reason = "requirement not met"
+		}
+		rejected = append(rejected, promo.explain(c.contents, money.Money{}, reason))
+	}
+	// return stock held for promotions which no longer apply
+	for sku, cached := range c.promoCache {
+		if !claimed[sku] {
+			if err := c.shop.ReleaseInventory(*cached); err != nil {
+				errors = append(errors, fmt.Errorf(`internal error: %w`, err))
 			}
+			delete(c.promoCache, sku)
 		}
 	}
 	if len(errors) == 0 { // no errors, so we return a null pointer
 		errors = nil
 	}
-	return c.contents, promoItems, errors
+	return &CartView{
+		Items:          copyProducts(c.contents),
+		PromotionItems: promoItems,
+		Lines:          c.cartLines(),
+		PromotionLines: promoLines,
+		Skipped:        skippedPromotions(skipped),
+		Applied:        explained,
+		Rejected:       rejected,
+		Errors:         errors,
+	}
 }
 
-// RetrieveCart retrieves a cart from memory or creates a new one
-func RetrieveCart(cartId *uuid.UUID) (*uuid.UUID, *Cart) {
+// adjustPromoClaim brings the stock held for a promotion in line with what the promotion currently grants.
+// The caller must hold the cart's lock.
+func (c *Cart) adjustPromoClaim(claim *Product) (*Product, error) {
+	cached, ok := c.promoCache[claim.SKU]
+	if !ok {
+		cached = &Product{
+			SKU:   claim.SKU,
+			Count: 0,
+		}
+	}
+	delta := claim.Count - cached.Count
+	if delta < 0 {
+		if err := c.shop.ReleaseInventory(Product{SKU: claim.SKU, Count: -delta}); err != nil {
+			return nil, err
+		}
+		cached.Count = claim.Count
+		c.promoCache[claim.SKU] = cached
+		return cached, nil
+	}
+	toClaim := *claim
+	toClaim.Count = delta
+	actual, err := c.shop.ClaimInventory(toClaim)
+	if actual == nil {
+		return nil, err
+	}
+	actual.Count += cached.Count
+	c.promoCache[actual.SKU] = actual
+	return actual, err
+}
+
+// Remove removes up to the given count of a product from the cart and returns the stock to the inventory
+func (c *Cart) Remove(product *Product) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.persist()
+	if c.released {
+		return errCartExpired
+	}
+	c.touch(c.shop.clock.Now())
+	if product.Count <= 0 {
+		return fmt.Errorf(`invalid count %d for SKU "%s"`, product.Count, product.SKU)
+	}
+	inCart, ok := c.contents[product.SKU]
+	if !ok {
+		return fmt.Errorf(`SKU "%s" is not in cart`, product.SKU)
+	}
+	count := product.Count
+	if count > inCart.Count {
+		count = inCart.Count
+	}
+	if err := c.shop.ReleaseInventory(Product{SKU: product.SKU, Count: count}); err != nil {
+		return err
+	}
+	inCart.Count -= count
+	if inCart.Count == 0 {
+		delete(c.contents, product.SKU)
+	}
+	return nil
+}
+
+// Clear removes all products from the cart and returns their stock to the inventory
+func (c *Cart) Clear() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.persist()
+	if c.released {
+		return errCartExpired
+	}
+	c.touch(c.shop.clock.Now())
+	c.releaseClaims()
+	return nil
+}
+
+// releaseClaims returns all stock held by the cart to the inventory. The caller must hold the cart's lock.
+func (c *Cart) releaseClaims() []*Product {
+	released := make([]*Product, 0)
+	for _, claims := range []map[string]*Product{c.contents, c.promoCache} {
+		for _, p := range claims {
+			if err := c.shop.ReleaseInventory(*p); err != nil {
+				glog.Warningf("Could not release %d of %s: %+v", p.Count, p.SKU, err)
+				continue
+			}
+			prodCopy := *p
+			released = append(released, &prodCopy)
+		}
+	}
+	c.contents = nil
+	c.promoCache = nil
+	return released
+}
+
+// persist stores the cart's state in the cart repository. The caller must hold the cart's lock.
+func (c *Cart) persist() {
+	if c.released {
+		return
+	}
+	c.syncLines()
+	record := &CartRecord{
+		Contents:   copyProducts(c.contents),
+		Lines:      append([]LineRef{}, c.lines...),
+		NextLine:   c.nextLine,
+		PromoCache: copyProducts(c.promoCache),
+		Coupons:    append([]string{}, c.coupons...),
+		Expires:    c.expires,
+	}
+	if err := c.shop.cartRepository.Put(c.id, record); err != nil {
+		glog.Errorf("Could not store cart %s: %+v", c.id, err)
+	}
+}
+
+// forget removes the cart from the cart repository. The caller must hold the cart's lock.
+func (c *Cart) forget() {
+	if err := c.shop.cartRepository.Delete(c.id); err != nil {
+		glog.Errorf("Could not delete cart %s: %+v", c.id, err)
+	}
+}
+
+// TotalPrice sums up the prices of all items in the given product maps
+func TotalPrice(items ...map[string]*Product) money.Money {
+	total := money.Money{}
+	for _, products := range items {
+		for _, p := range products {
+			total = total.Add(p.Price.Mul(int64(p.Count)))
+		}
+	}
+	return total
+}
+
+// copyProducts copies a product map so it can be handed out without holding the cart's lock
+func copyProducts(products map[string]*Product) map[string]*Product {
+	if products == nil {
+		return nil
+	}
+	productsCopy := make(map[string]*Product, len(products))
+	for sku, p := range products {
+		prodCopy := *p
+		productsCopy[sku] = &prodCopy
+	}
+	return productsCopy
+}
+
+// RetrieveCart retrieves a cart from memory or creates a new one. Retrieving a cart extends its expiry, which is
+// stored with the next change to the cart.
+func (s *Shop) RetrieveCart(cartId *uuid.UUID) (*uuid.UUID, *Cart) {
+	cartId, cart, created := s.findCart(cartId)
+	if created {
+		cart.lock.Lock()
+		cart.persist()
+		cart.lock.Unlock()
+	}
+	return cartId, cart
+}
+
+// findCart finds a cart held by the shop and touches it, or creates a new one
+func (s *Shop) findCart(cartId *uuid.UUID) (*uuid.UUID, *Cart, bool) {
+	s.cartsLock.Lock()
+	defer s.cartsLock.Unlock()
 	var cart *Cart
 	var exists bool
 	if cartId != nil {
-		cart, exists = carts[*cartId]
+		cart, exists = s.carts[*cartId]
 	} else {
 		exists = false
 		newId := uuid.New()
 		cartId = &newId
 	}
+	now := s.clock.Now()
+	if exists && cart.expiredAt(now) { // expired but not reaped yet
+		cart.expire()
+		exists = false
+	}
 	if !exists {
 		cart = &Cart{
+			shop:       s,
+			id:         *cartId,
 			contents:   nil,
 			promoCache: nil,
-			expires:    time.Now().Add(600 * time.Second),
+			expires:    now.Add(s.CartTTL()),
 		}
-		carts[*cartId] = cart
+		s.carts[*cartId] = cart
 	}
-	return cartId, cart
+	cart.lock.Lock()
+	cart.touch(now)
+	cart.lock.Unlock()
+	return cartId, cart, !exists
+}
+
+// ExistingCart retrieves a cart held by the shop without creating one. A cart which has expired but not been
+// reaped yet is reaped instead.
+func (s *Shop) ExistingCart(cartId uuid.UUID) (*Cart, bool) {
+	s.cartsLock.Lock()
+	defer s.cartsLock.Unlock()
+	cart, exists := s.carts[cartId]
+	if !exists {
+		return nil, false
+	}
+	if cart.expiredAt(s.clock.Now()) {
+		cart.expire()
+		delete(s.carts, cartId)
+		return nil, false
+	}
+	return cart, true
+}
+
+// CartExists checks if a cart is currently held by the shop and has not expired
+func (s *Shop) CartExists(cartId uuid.UUID) bool {
+	_, exists := s.ExistingCart(cartId)
+	return exists
 }
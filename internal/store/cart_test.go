@@ -1,41 +1,102 @@
 package store_test
 
 import (
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/money"
 	"github.com/jsfan/fake-shop/internal/store"
 	"reflect"
 	"testing"
 )
 
-func setupShop() (*store.Cart, error) {
+func setupShop() (*store.Shop, *store.Cart, error) {
+	shop, err := newTestShop()
+	if err != nil {
+		return nil, nil, err
+	}
+	_, cart := shop.RetrieveCart(nil)
+	return shop, cart, nil
+}
+
+func newTestShop() (*store.Shop, error) {
+	shop := store.NewMemoryShop()
+	return shop, stockShop(shop)
+}
+
+func stockShop(shop *store.Shop) error {
 	stock := []*store.Product{
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 10,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Stick",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 5,
 		},
 	}
-	if err := store.StockShop(stock); err != nil {
-		return nil, err
+	return shop.StockShop(stock)
+}
+
+// countingCarts is a cart repository which counts how often carts are stored
+type countingCarts struct {
+	store.CartRepository
+	puts int
+}
+
+func (c *countingCarts) Put(cartId uuid.UUID, cart *store.CartRecord) error {
+	c.puts++
+	return c.CartRepository.Put(cartId, cart)
+}
+
+func TestCart_ViewStoresOnlyChanges(t *testing.T) {
+	carts := &countingCarts{CartRepository: store.NewMemoryCarts()}
+	shop, err := store.NewShop(store.NewMemoryInventory(), store.NewMemoryPromotions(), carts, store.NewMemoryOrders(), store.SystemClock)
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{SKU: "A1234", Count: 1},
+			Rule:     store.RuleDetail{SKU: "B1234", Count: 1},
+		},
+	})
+	cartId, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	stored := carts.puts
+	cart.Get() // claims the freebie
+	if carts.puts != stored+1 {
+		t.Errorf("Cart not stored after claiming a freebie. Expected %d writes, got %d.", stored+1, carts.puts)
+	}
+	stored = carts.puts
+	for i := 0; i < 3; i++ {
+		shop.RetrieveCart(cartId)
+		cart.Get()
+	}
+	if carts.puts != stored {
+		t.Errorf("Reading the cart stored it. Expected %d writes, got %d.", stored, carts.puts)
 	}
-	return &store.Cart{}, nil
 }
 
 func TestCart_Add(t *testing.T) {
-	c, err := setupShop()
+	_, c, err := setupShop()
 	if err != nil {
 		t.Fatalf("Test setup failed: %+v", err)
 	}
 	err = c.Add(&store.Product{
 		SKU:   "A1234",
 		Name:  "Carrot",
-		Price: 1.1,
+		Price: money.MustParse("1.1"),
 		Count: 5,
 	})
 	if err != nil {
@@ -44,7 +105,7 @@ func TestCart_Add(t *testing.T) {
 	err = c.Add(&store.Product{
 		SKU:   "A1234",
 		Name:  "Carrot",
-		Price: 1.1,
+		Price: money.MustParse("1.1"),
 		Count: 5,
 	})
 	if err != nil {
@@ -53,7 +114,7 @@ func TestCart_Add(t *testing.T) {
 	err = c.Add(&store.Product{
 		SKU:   "A1234",
 		Name:  "Carrot",
-		Price: 1.1,
+		Price: money.MustParse("1.1"),
 		Count: 1,
 	})
 	if err == nil || err.Error() != "not enough stock" {
@@ -62,7 +123,7 @@ func TestCart_Add(t *testing.T) {
 }
 
 func TestCart_Update(t *testing.T) {
-	c, err := setupShop()
+	_, c, err := setupShop()
 	if err != nil {
 		t.Fatalf("Test setup failed: %+v", err)
 	}
@@ -70,13 +131,13 @@ func TestCart_Update(t *testing.T) {
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 10,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Carrot",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 5,
 		},
 	}
@@ -89,13 +150,13 @@ func TestCart_Update(t *testing.T) {
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 5,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Carrot",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 3,
 		},
 	}
@@ -107,13 +168,13 @@ func TestCart_Update(t *testing.T) {
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 5,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Carrot",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 10,
 		},
 	}
@@ -130,7 +191,7 @@ func TestCart_Update(t *testing.T) {
 }
 
 func TestCart_Get(t *testing.T) {
-	c, err := setupShop()
+	shop, c, err := setupShop()
 	if err != nil {
 		t.Fatalf("Test setup failed: %+v", err)
 	}
@@ -154,13 +215,13 @@ func TestCart_Get(t *testing.T) {
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 1,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Stick",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 3,
 		},
 	}
@@ -190,11 +251,11 @@ func TestCart_Get(t *testing.T) {
 		"FREEBIE": {
 			SKU:   "FREEBIE",
 			Name:  "A freebie",
-			Price: 0,
+			Price: money.MustParse("0"),
 			Count: 1,
 		},
 	}
-	store.RegisterPromotions(promos)
+	shop.RegisterPromotions(promos)
 	cart, promo, errors = c.Get()
 	if !reflect.DeepEqual(cart, expectedCart) {
 		t.Errorf("Retrieved cart does not contain expected items. Expected %+v, got +%v.", expectedCart, cart)
@@ -205,5 +266,339 @@ func TestCart_Get(t *testing.T) {
 	if errors != nil {
 		t.Errorf("Got unexpected error when retrieving cart: %+v", errors)
 	}
-	store.RegisterPromotions(promos)
+	shop.RegisterPromotions(promos)
+}
+
+func TestCart_Remove(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 5}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if err := c.Remove(&store.Product{SKU: "B1234", Count: 1}); err == nil {
+		t.Error("Removing a product not in the cart did not throw an error.")
+	}
+	if err := c.Remove(&store.Product{SKU: "A1234", Count: 0}); err == nil {
+		t.Error("Removing a zero count did not throw an error.")
+	}
+	if err := c.Remove(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Removing from cart failed: %+v", err)
+	}
+	cart, _, _ := c.Get()
+	if cart["A1234"].Count != 3 {
+		t.Errorf("Unexpected count in cart. Expected 3, got %d.", cart["A1234"].Count)
+	}
+	if count := shop.GetInventory()["A1234"].Count; count != 7 {
+		t.Errorf("Stock not returned to inventory. Expected 7, got %d.", count)
+	}
+	if err := c.Remove(&store.Product{SKU: "A1234", Count: 10}); err != nil {
+		t.Fatalf("Removing more than in cart failed: %+v", err)
+	}
+	cart, _, _ = c.Get()
+	if _, ok := cart["A1234"]; ok {
+		t.Errorf("Product still in cart after removing all of it: %+v", cart["A1234"])
+	}
+	if count := shop.GetInventory()["A1234"].Count; count != 10 {
+		t.Errorf("Stock not returned to inventory. Expected 10, got %d.", count)
+	}
+}
+
+func TestCart_Clear(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+	})
+	errors := c.Update([]*store.Product{
+		{
+			SKU:   "A1234",
+			Count: 2,
+		},
+		{
+			SKU:   "B1234",
+			Count: 1,
+		},
+	})
+	if errors != nil {
+		t.Fatalf("Updating cart failed unexpectedly: %+v", errors)
+	}
+	if _, _, errors := c.Get(); errors != nil { // claims freebies
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	if err := c.Clear(); err != nil {
+		t.Fatalf("Clearing cart failed: %+v", err)
+	}
+	cart, promo, _ := c.Get()
+	if len(cart) != 0 || len(promo) != 0 {
+		t.Errorf("Cart not empty after clearing: %+v, %+v", cart, promo)
+	}
+	inventory := shop.GetInventory()
+	if inventory["A1234"].Count != 10 || inventory["B1234"].Count != 5 {
+		t.Errorf("Stock not returned to inventory: %+v, %+v", inventory["A1234"], inventory["B1234"])
+	}
+}
+
+func TestCart_GetReleasesStalePromoClaims(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+	})
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 3}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, _, errors := c.Get(); errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	if err := c.Remove(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Removing from cart failed: %+v", err)
+	}
+	_, promo, errors := c.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	if promo["FREEBIE"].Count != 1 {
+		t.Errorf("Unexpected freebie count. Expected 1, got %d.", promo["FREEBIE"].Count)
+	}
+	if count := shop.GetInventory()["B1234"].Count; count != 4 {
+		t.Errorf("Freebie stock not returned. Expected 4, got %d.", count)
+	}
+	if err := c.Remove(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Removing from cart failed: %+v", err)
+	}
+	if _, _, errors := c.Get(); errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	if count := shop.GetInventory()["B1234"].Count; count != 5 {
+		t.Errorf("Freebie stock not returned. Expected 5, got %d.", count)
+	}
+}
+
+func TestTotalPrice(t *testing.T) {
+	items := map[string]*store.Product{
+		"120P90": {
+			SKU:   "120P90",
+			Name:  "Google Home",
+			Price: money.MustParse("49.99"),
+			Count: 3,
+		},
+	}
+	promoItems := map[string]*store.Product{
+		"10PCOFF": {
+			SKU:   "10PCOFF",
+			Name:  "10% off",
+			Price: money.MustParse("-5.00"),
+			Count: 3,
+		},
+	}
+	if total := store.TotalPrice(items); total != money.MustParse("149.97") {
+		t.Errorf("Incorrect total. Expected 149.97 USD, got %s.", total)
+	}
+	if total := store.TotalPrice(items, promoItems); total != money.MustParse("134.97") {
+		t.Errorf("Incorrect total. Expected 134.97 USD, got %s.", total)
+	}
+	if total := store.TotalPrice(); !total.IsZero() {
+		t.Errorf("Incorrect total for no items. Expected 0, got %s.", total)
+	}
+}
+
+func TestCart_GetCartPromotion(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err = shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "10% off orders over 4.50",
+			SKU:      "10OVER5",
+			Category: "cart",
+			Requires: store.Requirement{
+				MinSpend: money.MustParse("4.5"),
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".1"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 4}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promo, _ := c.Get(); len(promo) != 0 {
+		t.Errorf("Cart promotion applied below threshold: %+v", promo)
+	}
+	if err := c.Add(&store.Product{SKU: "B1234", Count: 6}); err == nil {
+		t.Fatal("Expected partial claim for B1234.")
+	}
+	cartItems, promo, errors := c.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	expected := &store.Product{
+		SKU:   "10OVER5",
+		Name:  "10% off orders over 4.50",
+		Price: money.MustParse("-0.49"),
+		Count: 1,
+	}
+	if !reflect.DeepEqual(promo["10OVER5"], expected) {
+		t.Errorf("Cart promotion not applied. Expected %+v, got %+v.", expected, promo["10OVER5"])
+	}
+	if total := store.TotalPrice(cartItems, promo); total != money.MustParse("4.41") {
+		t.Errorf("Unexpected total. Expected 4.41 USD, got %s.", total)
+	}
+}
+
+func TestCart_GetBuyGet(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err = shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "Half price stick with 2 carrots",
+			SKU:      "STICKHALF",
+			Category: "bxgy",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 2,
+			},
+			Rule: store.RuleDetail{
+				SKU:        "B1234",
+				Count:      1,
+				Discount:   money.MustParseRate(".5"),
+				MaxRewards: 2,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 6}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	cartItems, promo, errors := c.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	expected := &store.Product{
+		SKU:   "STICKHALF",
+		Name:  "Half price stick with 2 carrots",
+		Price: money.MustParse("0.05"),
+		Count: 2,
+	}
+	if !reflect.DeepEqual(promo["STICKHALF"], expected) {
+		t.Errorf("Reward not applied. Expected %+v, got %+v.", expected, promo["STICKHALF"])
+	}
+	if total := store.TotalPrice(cartItems, promo); total != money.MustParse("6.7") {
+		t.Errorf("Unexpected total. Expected 6.70 USD, got %s.", total)
+	}
+	if count := shop.GetInventory()["B1234"].Count; count != 3 {
+		t.Errorf("Reward stock not claimed. Expected 3, got %d.", count)
+	}
+
+	if errors := c.Update([]*store.Product{{SKU: "A1234", Count: 3}}); errors != nil {
+		t.Fatalf("Updating cart failed: %+v", errors)
+	}
+	if _, promo, _ = c.Get(); promo["STICKHALF"] == nil || promo["STICKHALF"].Count != 1 {
+		t.Errorf("Unexpected reward after removing carrots: %+v", promo["STICKHALF"])
+	}
+	if count := shop.GetInventory()["B1234"].Count; count != 4 {
+		t.Errorf("Reward stock not released. Expected 4, got %d.", count)
+	}
+}
+
+func TestCart_GetBuyGetForeignAmount(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	promo := &store.Promotion{
+		Name:     "A euro off a stick with a carrot",
+		SKU:      "STICKEURO",
+		Category: "bxgy",
+		Requires: store.Requirement{SKU: "A1234", Count: 1},
+		Rule:     store.RuleDetail{SKU: "B1234", Count: 1, Amount: money.MustParse("1 EUR")},
+	}
+	if err := shop.CreatePromotion(promo); err == nil {
+		t.Error("Creating a promotion with an amount in another currency did not throw an error.")
+	}
+	if err := shop.RegisterPromotions([]*store.Promotion{promo}); err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promos, errors := c.Get(); len(promos) != 0 || len(errors) == 0 {
+		t.Errorf("Promotion in another currency applied or not reported: %+v (%+v)", promos, errors)
+	}
+	if count := shop.GetInventory()["B1234"].Count; count != 5 {
+		t.Errorf("Reward stock claimed. Expected 5, got %d.", count)
+	}
+}
+
+func TestCart_ViewLines(t *testing.T) {
+	_, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	lineSKUs := func() []string {
+		skus := make([]string, 0)
+		for _, line := range c.View().Lines {
+			skus = append(skus, line.ID+":"+line.Product.SKU)
+		}
+		return skus
+	}
+	if err := c.Add(&store.Product{SKU: "B1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "B1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if expected, lines := []string{"1:B1234", "2:A1234"}, lineSKUs(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected lines. Expected %+v, got %+v.", expected, lines)
+	}
+	if err := c.Remove(&store.Product{SKU: "B1234", Count: 2}); err != nil {
+		t.Fatalf("Removing from cart failed: %+v", err)
+	}
+	if errors := c.Update([]*store.Product{{SKU: "B1234", Count: 1}, {SKU: "A1234", Count: 3}}); errors != nil {
+		t.Fatalf("Updating cart failed: %+v", errors)
+	}
+	if expected, lines := []string{"2:A1234", "3:B1234"}, lineSKUs(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected lines after removing and adding again. Expected %+v, got %+v.", expected, lines)
+	}
 }
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"strings"
+	"time"
+)
+
+// errCodeExhausted is returned by a PromotionRepository when a coupon code has reached its usage limit
+var errCodeExhausted = errors.New("usage limit reached")
+
+// normaliseCode brings a coupon code into the form it is matched in
+func normaliseCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// findCoupon finds the promotion unlocked by a coupon code
+func findCoupon(promos []*Promotion, code string) *Promotion {
+	for _, p := range promos {
+		if p.Code != "" && normaliseCode(p.Code) == code {
+			return p
+		}
+	}
+	return nil
+}
+
+// codeExpired checks if a promotion's coupon code can no longer be used at the given time
+func (p *Promotion) codeExpired(now time.Time) bool {
+	return !p.CodeExpires.IsZero() && !now.Before(p.CodeExpires)
+}
+
+// ApplyCoupon applies a coupon code to the cart, using up one of the code's uses until the coupon is removed
+// or the cart expires
+func (c *Cart) ApplyCoupon(code string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.persist()
+	if c.released {
+		return errCartExpired
+	}
+	now := c.shop.clock.Now()
+	c.touch(now)
+	code = normaliseCode(code)
+	for _, applied := range c.coupons {
+		if applied == code {
+			return fmt.Errorf(`coupon "%s" is already applied`, code)
+		}
+	}
+	promos, err := c.shop.promotions.All()
+	if err != nil {
+		return fmt.Errorf(`internal error: %w`, err)
+	}
+	promo := findCoupon(promos, code)
+	if promo == nil {
+		return fmt.Errorf(`coupon "%s" is not valid`, code)
+	}
+	if promo.codeExpired(now) {
+		return fmt.Errorf(`coupon "%s" has expired`, code)
+	}
+	if !promo.activeAt(now) {
+		return fmt.Errorf(`coupon "%s" is not valid at this time`, code)
+	}
+	if err := c.shop.promotions.ClaimCode(code, promo.MaxUses); err != nil {
+		if errors.Is(err, errCodeExhausted) {
+			return fmt.Errorf(`coupon "%s" has been used up`, code)
+		}
+		return fmt.Errorf(`internal error: %w`, err)
+	}
+	c.coupons = append(c.coupons, code)
+	return nil
+}
+
+// RemoveCoupon removes a coupon code from the cart and gives back its use
+func (c *Cart) RemoveCoupon(code string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	defer c.persist()
+	if c.released {
+		return errCartExpired
+	}
+	c.touch(c.shop.clock.Now())
+	code = normaliseCode(code)
+	for i, applied := range c.coupons {
+		if applied == code {
+			if err := c.shop.promotions.ReleaseCode(code); err != nil {
+				return fmt.Errorf(`internal error: %w`, err)
+			}
+			c.coupons = append(c.coupons[:i], c.coupons[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf(`coupon "%s" is not applied`, code)
+}
+
+// Coupons lists the coupon codes applied to the cart in the order they were applied
+func (c *Cart) Coupons() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string{}, c.coupons...)
+}
+
+// checkCoupons determines which of the cart's coupon codes currently unlock a promotion.
+// The caller must hold the cart's lock.
+func (c *Cart) checkCoupons(promos []*Promotion, now time.Time) (valid map[string]bool, errors []error) {
+	valid = make(map[string]bool, len(c.coupons))
+	for _, code := range c.coupons {
+		promo := findCoupon(promos, code)
+		switch {
+		case promo == nil:
+			errors = append(errors, fmt.Errorf(`coupon "%s" is no longer valid`, code))
+		case promo.codeExpired(now):
+			errors = append(errors, fmt.Errorf(`coupon "%s" has expired`, code))
+		case !promo.activeAt(now):
+			errors = append(errors, fmt.Errorf(`coupon "%s" is not valid at this time`, code))
+		default:
+			valid[code] = true
+		}
+	}
+	return valid, errors
+}
+
+// releaseCoupons gives back the uses of all coupon codes applied to the cart except those to keep.
+// The caller must hold the cart's lock.
+func (c *Cart) releaseCoupons(keep map[string]bool) {
+	for _, code := range c.coupons {
+		if keep[code] {
+			continue
+		}
+		if err := c.shop.promotions.ReleaseCode(code); err != nil {
+			glog.Warningf("Could not release coupon %s: %+v", code, err)
+		}
+	}
+	c.coupons = nil
+}
@@ -0,0 +1,117 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"testing"
+	"time"
+)
+
+func setupCouponShop(t *testing.T, clock store.Clock) (*store.Shop, *store.Cart) {
+	shop, err := store.NewShop(store.NewMemoryInventory(), store.NewMemoryPromotions(), store.NewMemoryCarts(), store.NewMemoryOrders(), clock)
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err = shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:        "10% off carrots",
+			SKU:         "CARROT10",
+			Category:    "discount",
+			Code:        "Carrot10",
+			MaxUses:     1,
+			CodeExpires: clock.Now().Add(time.Hour),
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".1"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	_, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	return shop, cart
+}
+
+func TestCart_ApplyCoupon(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	shop, cart := setupCouponShop(t, clock)
+	if _, promo, _ := cart.Get(); len(promo) != 0 {
+		t.Errorf("Coupon promotion applied without its code: %+v", promo)
+	}
+	if err := cart.ApplyCoupon("NOPE"); err == nil || err.Error() != `coupon "NOPE" is not valid` {
+		t.Errorf("Did not get expected error for an unknown code: %+v", err)
+	}
+	if err := cart.ApplyCoupon(" carrot10 "); err != nil {
+		t.Fatalf("Applying coupon failed: %+v", err)
+	}
+	if err := cart.ApplyCoupon("CARROT10"); err == nil || err.Error() != `coupon "CARROT10" is already applied` {
+		t.Errorf("Did not get expected error for a repeated code: %+v", err)
+	}
+	_, promo, errors := cart.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	expected := money.MustParse("-0.11")
+	if p, ok := promo["CARROT10"]; !ok || p.Price != expected || p.Count != 2 {
+		t.Errorf("Coupon promotion not applied. Expected %s for 2, got %+v.", expected, promo)
+	}
+
+	_, other := shop.RetrieveCart(nil)
+	if err := other.ApplyCoupon("CARROT10"); err == nil || err.Error() != `coupon "CARROT10" has been used up` {
+		t.Errorf("Did not get expected error for an exhausted code: %+v", err)
+	}
+	if err := cart.RemoveCoupon("CARROT10"); err != nil {
+		t.Fatalf("Removing coupon failed: %+v", err)
+	}
+	if err := cart.RemoveCoupon("CARROT10"); err == nil || err.Error() != `coupon "CARROT10" is not applied` {
+		t.Errorf("Did not get expected error for removing a code twice: %+v", err)
+	}
+	if err := other.ApplyCoupon("CARROT10"); err != nil {
+		t.Fatalf("Applying a released coupon failed: %+v", err)
+	}
+	if coupons := other.Coupons(); len(coupons) != 1 || coupons[0] != "CARROT10" {
+		t.Errorf("Unexpected coupons on cart: %+v", coupons)
+	}
+
+	clock.Advance(time.Hour)
+	if err := cart.ApplyCoupon("CARROT10"); err == nil || err.Error() != `coupon "CARROT10" has expired` {
+		t.Errorf("Did not get expected error for an expired code: %+v", err)
+	}
+	if _, promo, errors := other.Get(); len(promo) != 0 || len(errors) != 1 {
+		t.Errorf("Expired coupon still applied. Got %+v, %+v.", promo, errors)
+	}
+}
+
+func TestCart_ApplyCouponReleasedOnExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	shop, cart := setupCouponShop(t, clock)
+	if err := cart.ApplyCoupon("CARROT10"); err != nil {
+		t.Fatalf("Applying coupon failed: %+v", err)
+	}
+	shop.ReapCarts(clock.Now().Add(shop.CartTTL()))
+	_, other := shop.RetrieveCart(nil)
+	if err := other.ApplyCoupon("CARROT10"); err != nil {
+		t.Errorf("Coupon not released from expired cart: %+v", err)
+	}
+}
+
+func TestRegisterPromotions_DuplicateCode(t *testing.T) {
+	shop := store.NewMemoryShop()
+	err := shop.RegisterPromotions([]*store.Promotion{
+		{Name: "One", SKU: "ONE", Category: "discount", Code: "SAME"},
+		{Name: "Two", SKU: "TWO", Category: "discount", Code: "same"},
+	})
+	if err == nil {
+		t.Error("Registering promotions with a duplicate code did not throw an error.")
+	}
+}
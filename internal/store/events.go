@@ -0,0 +1,109 @@
+package store
+
+import (
+	"github.com/google/uuid"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CartEventKind int
+
+const (
+	// CartExpiryWarning is sent once when a cart enters its warning window before expiry
+	CartExpiryWarning CartEventKind = iota
+	// CartExpired is sent when a cart has expired and was removed
+	CartExpired
+	// CartStockReleased is sent after the stock claimed by an expired cart was returned to the inventory
+	CartStockReleased
+	// CartCheckedOut is sent when a cart was turned into an order
+	CartCheckedOut
+)
+
+const defaultExpiryWarning = 60 * time.Second
+
+// eventBuffer is the number of events buffered per subscriber before further events are dropped
+const eventBuffer = 8
+
+type CartEvent struct {
+	CartID   uuid.UUID
+	Kind     CartEventKind
+	Expires  time.Time
+	Released []*Product
+}
+
+// SetExpiryWarning sets how long before a cart's expiry subscribers are warned
+func (s *Shop) SetExpiryWarning(warning time.Duration) {
+	atomic.StoreInt64(&s.expiryWarning, int64(warning))
+}
+
+// ExpiryWarning returns how long before a cart's expiry subscribers are warned
+func (s *Shop) ExpiryWarning() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.expiryWarning))
+}
+
+// SubscribeCartEvents subscribes to lifecycle events of a cart. The returned function ends the subscription.
+func (s *Shop) SubscribeCartEvents(cartId uuid.UUID) (<-chan CartEvent, func()) {
+	events := make(chan CartEvent, eventBuffer)
+	s.subscribersLock.Lock()
+	defer s.subscribersLock.Unlock()
+	if _, ok := s.subscribers[cartId]; !ok {
+		s.subscribers[cartId] = make(map[chan CartEvent]struct{})
+	}
+	s.subscribers[cartId][events] = struct{}{}
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			s.subscribersLock.Lock()
+			defer s.subscribersLock.Unlock()
+			delete(s.subscribers[cartId], events)
+			if len(s.subscribers[cartId]) == 0 {
+				delete(s.subscribers, cartId)
+			}
+			close(events)
+		})
+	}
+}
+
+// publishCartEvent sends an event to all subscribers of the cart without blocking on slow subscribers
+func (s *Shop) publishCartEvent(event CartEvent) {
+	s.subscribersLock.Lock()
+	defer s.subscribersLock.Unlock()
+	for events := range s.subscribers[event.CartID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// warnIfExpiring warns subscribers once if the cart expires within the warning window
+func (c *Cart) warnIfExpiring(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.released || c.warned || now.Add(c.shop.ExpiryWarning()).Before(c.expires) {
+		return
+	}
+	c.warned = true
+	c.shop.publishCartEvent(CartEvent{
+		CartID:  c.id,
+		Kind:    CartExpiryWarning,
+		Expires: c.expires,
+	})
+}
+
+// expire releases an expired cart and notifies its subscribers
+func (c *Cart) expire() {
+	expires, released := c.release()
+	c.shop.publishCartEvent(CartEvent{
+		CartID:  c.id,
+		Kind:    CartExpired,
+		Expires: expires,
+	})
+	c.shop.publishCartEvent(CartEvent{
+		CartID:   c.id,
+		Kind:     CartStockReleased,
+		Expires:  expires,
+		Released: released,
+	})
+}
@@ -0,0 +1,70 @@
+package store_test
+
+import (
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/store"
+	"testing"
+	"time"
+)
+
+func expectEvent(t *testing.T, events <-chan store.CartEvent, kind store.CartEventKind) store.CartEvent {
+	select {
+	case event := <-events:
+		if event.Kind != kind {
+			t.Fatalf("Got unexpected event. Expected kind %d, got %+v.", kind, event)
+		}
+		return event
+	default:
+		t.Fatalf("Did not get expected event of kind %d.", kind)
+	}
+	return store.CartEvent{}
+}
+
+func TestSubscribeCartEvents(t *testing.T) {
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	events, unsubscribe := shop.SubscribeCartEvents(cartId)
+	defer unsubscribe()
+
+	shop.ReapCarts(time.Now())
+	select {
+	case event := <-events:
+		t.Fatalf("Got unexpected event for a fresh cart: %+v", event)
+	default:
+	}
+
+	warnAt := time.Now().Add(shop.CartTTL() - shop.ExpiryWarning())
+	shop.ReapCarts(warnAt)
+	expectEvent(t, events, store.CartExpiryWarning)
+	shop.ReapCarts(warnAt)
+	select {
+	case event := <-events:
+		t.Fatalf("Got repeated warning: %+v", event)
+	default:
+	}
+
+	shop.ReapCarts(time.Now().Add(shop.CartTTL()))
+	expectEvent(t, events, store.CartExpired)
+	released := expectEvent(t, events, store.CartStockReleased)
+	if len(released.Released) != 1 || released.Released[0].SKU != "A1234" || released.Released[0].Count != 2 {
+		t.Errorf("Unexpected released stock: %+v", released.Released)
+	}
+}
+
+func TestSubscribeCartEvents_Unsubscribe(t *testing.T) {
+	shop := store.NewMemoryShop()
+	cartId := uuid.New()
+	events, unsubscribe := shop.SubscribeCartEvents(cartId)
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Event channel not closed after unsubscribing.")
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/glog"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCartTTL = 600 * time.Second
+
+// SetCartTTL sets how long a cart is kept after its last activity
+func (s *Shop) SetCartTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf(`cart TTL must be positive, got %s`, ttl)
+	}
+	atomic.StoreInt64(&s.cartTTL, int64(ttl))
+	return nil
+}
+
+// CartTTL returns how long a cart is kept after its last activity
+func (s *Shop) CartTTL() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.cartTTL))
+}
+
+// touch extends the cart's lifetime. The caller must hold the cart's lock.
+func (c *Cart) touch(now time.Time) {
+	c.expires = now.Add(c.shop.CartTTL())
+	c.warned = false
+}
+
+// expiredAt checks if the cart has expired at the given time
+func (c *Cart) expiredAt(now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.released || !now.Before(c.expires)
+}
+
+// release returns all stock and coupon uses claimed by the cart and marks the cart as released
+func (c *Cart) release() (expires time.Time, released []*Product) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	released = c.releaseClaims()
+	c.releaseCoupons(nil)
+	c.released = true
+	c.forget()
+	return c.expires, released
+}
+
+// ReapCarts deletes all carts which have expired at the given time and releases their stock.
+// Carts about to expire get a warning sent to their subscribers.
+func (s *Shop) ReapCarts(now time.Time) int {
+	s.cartsLock.Lock()
+	defer s.cartsLock.Unlock()
+	reaped := 0
+	for id, cart := range s.carts {
+		if cart.expiredAt(now) {
+			cart.expire()
+			delete(s.carts, id)
+			reaped++
+		} else {
+			cart.warnIfExpiring(now)
+		}
+	}
+	return reaped
+}
+
+// RunCartReaper periodically reaps expired carts until the context is cancelled
+func (s *Shop) RunCartReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if reaped := s.ReapCarts(s.clock.Now()); reaped > 0 {
+				glog.Infof("Reaped %d expired carts", reaped)
+			}
+		}
+	}
+}
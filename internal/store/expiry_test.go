@@ -0,0 +1,167 @@
+package store_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/store"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock which only moves when told to
+type fakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSetCartTTL(t *testing.T) {
+	shop := store.NewMemoryShop()
+	if err := shop.SetCartTTL(0); err == nil {
+		t.Error("Setting a zero cart TTL did not throw an error.")
+	}
+	if err := shop.SetCartTTL(time.Minute); err != nil {
+		t.Fatalf("Setting cart TTL failed: %+v", err)
+	}
+	if shop.CartTTL() != time.Minute {
+		t.Errorf("Cart TTL not set. Expected %s, got %s.", time.Minute, shop.CartTTL())
+	}
+}
+
+func TestReapCarts(t *testing.T) {
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+	})
+
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 3}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, _, errors := cart.Get(); errors != nil { // claims freebies
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	inventory := shop.GetInventory()
+	if inventory["A1234"].Count != 7 || inventory["B1234"].Count != 2 {
+		t.Fatalf("Unexpected inventory after claiming stock: %+v, %+v", inventory["A1234"], inventory["B1234"])
+	}
+
+	if reaped := shop.ReapCarts(time.Now()); reaped != 0 {
+		t.Errorf("Reaped %d carts before they expired.", reaped)
+	}
+	if reaped := shop.ReapCarts(time.Now().Add(shop.CartTTL())); reaped != 1 {
+		t.Errorf("Expected to reap 1 cart, reaped %d.", reaped)
+	}
+	inventory = shop.GetInventory()
+	if inventory["A1234"].Count != 10 || inventory["B1234"].Count != 5 {
+		t.Errorf("Stock not released from expired cart: %+v, %+v", inventory["A1234"], inventory["B1234"])
+	}
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 1}); err == nil {
+		t.Error("Adding to a reaped cart did not throw an error.")
+	}
+	_, newCart := shop.RetrieveCart(&cartId)
+	if newCart == cart {
+		t.Error("Retrieving a reaped cart returned the released cart.")
+	}
+}
+
+func TestReapCarts_ActivityExtendsExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	shop, err := store.NewShop(store.NewMemoryInventory(), store.NewMemoryPromotions(), store.NewMemoryCarts(), store.NewMemoryOrders(), clock)
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	created := clock.Now()
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	clock.Advance(time.Minute)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	// the cart was touched after creation, so it outlives its original expiry
+	if reaped := shop.ReapCarts(created.Add(shop.CartTTL())); reaped != 0 {
+		t.Errorf("Activity did not extend cart expiry, reaped %d carts.", reaped)
+	}
+	if reaped := shop.ReapCarts(clock.Now().Add(shop.CartTTL())); reaped != 1 {
+		t.Errorf("Expected to reap 1 cart, reaped %d.", reaped)
+	}
+}
+
+func TestExistingCart(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	shop, err := store.NewShop(store.NewMemoryInventory(), store.NewMemoryPromotions(), store.NewMemoryCarts(), store.NewMemoryOrders(), clock)
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	cartId := uuid.New()
+	if _, exists := shop.ExistingCart(cartId); exists {
+		t.Error("Found a cart which was never created.")
+	}
+	_, cart := shop.RetrieveCart(&cartId)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 3}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if existing, exists := shop.ExistingCart(cartId); !exists || existing != cart {
+		t.Errorf("Unexpected cart. Expected %p, got %p.", cart, existing)
+	}
+	clock.Advance(shop.CartTTL())
+	if _, exists := shop.ExistingCart(cartId); exists {
+		t.Error("Found a cart which has expired.")
+	}
+	if count := shop.GetInventory()["A1234"].Count; count != 10 {
+		t.Errorf("Stock not released from expired cart. Expected 10, got %d.", count)
+	}
+	if _, exists := shop.ExistingCart(cartId); exists {
+		t.Error("Looking up an expired cart created a new one.")
+	}
+}
+
+func TestRunCartReaper(t *testing.T) {
+	shop := store.NewMemoryShop()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		shop.RunCartReaper(ctx, time.Millisecond)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Cart reaper did not stop after cancellation.")
+	}
+}
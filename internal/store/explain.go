@@ -0,0 +1,103 @@
+package store
+
+import (
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/money"
+	"strings"
+)
+
+// PromotionExplanation describes how a promotion was evaluated against a cart
+type PromotionExplanation struct {
+	SKU      string
+	Name     string
+	Category string
+	// Requirement describes what a cart needs to qualify, e.g. `3 x "A1234"`
+	Requirement string
+	// Qualifying is the quantity in the cart counting towards the requirement. For bundles it is the number of
+	// complete bundles.
+	Qualifying int
+	// Saving is the amount the promotion takes off the cart. It is zero for promotions which were not applied.
+	Saving money.Money
+	// Reason explains why a promotion was not applied
+	Reason string
+}
+
+// DescribeRequirement describes what a cart needs to qualify for the promotion
+func (p *Promotion) DescribeRequirement() string {
+	switch p.Category {
+	case "cart":
+		parts := make([]string, 0, 2)
+		if !p.Requires.MinSpend.IsZero() {
+			parts = append(parts, fmt.Sprintf("spend of at least %s", p.Requires.MinSpend))
+		}
+		if p.Requires.Count > 0 {
+			if p.Requires.SKU != "" {
+				parts = append(parts, fmt.Sprintf(`at least %d x "%s"`, p.Requires.Count, p.Requires.SKU))
+			} else {
+				parts = append(parts, fmt.Sprintf("at least %d items", p.Requires.Count))
+			}
+		}
+		if len(parts) == 0 {
+			return "any purchase"
+		}
+		return strings.Join(parts, " and ")
+	case "bundle":
+		parts := make([]string, 0, len(p.Bundle))
+		for _, item := range p.Bundle {
+			parts = append(parts, fmt.Sprintf(`%d x "%s"`, item.Count, item.SKU))
+		}
+		return "bundle of " + strings.Join(parts, ", ")
+	case "tiered":
+		if len(p.Tiers) > 0 {
+			return fmt.Sprintf(`%d x "%s"`, p.Tiers[0].MinCount, p.Requires.SKU)
+		}
+	}
+	return fmt.Sprintf(`%d x "%s"`, p.Requires.Count, p.Requires.SKU)
+}
+
+// qualifying counts the quantity in a cart which counts towards the promotion's requirement
+func (p *Promotion) qualifying(contents map[string]*Product) int {
+	switch p.Category {
+	case "cart":
+		count := 0
+		for _, product := range contents {
+			if p.Requires.SKU == "" || product.SKU == p.Requires.SKU || product.Parent == p.Requires.SKU {
+				count += product.Count
+			}
+		}
+		return count
+	case "bundle":
+		bundles := -1
+		for _, item := range p.Bundle {
+			product, ok := contents[item.SKU]
+			if !ok || item.Count <= 0 {
+				return 0
+			}
+			if fits := product.Count / item.Count; bundles < 0 || fits < bundles {
+				bundles = fits
+			}
+		}
+		if bundles < 0 {
+			return 0
+		}
+		return bundles
+	}
+	if product, ok := contents[p.Requires.SKU]; ok {
+		return product.Count
+	}
+	return 0
+}
+
+// explain describes a promotion's evaluation against a cart's contents
+func (p *Promotion) explain(contents map[string]*Product, saving money.Money, reason string) *PromotionExplanation {
+	contents = p.promotionContents(contents)
+	return &PromotionExplanation{
+		SKU:         p.SKU,
+		Name:        p.Name,
+		Category:    p.Category,
+		Requirement: p.DescribeRequirement(),
+		Qualifying:  p.qualifying(contents),
+		Saving:      saving,
+		Reason:      reason,
+	}
+}
@@ -0,0 +1,93 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"reflect"
+	"testing"
+)
+
+func TestCart_ViewExplanations(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err = shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A discount",
+			SKU:      "DISCOUNT",
+			Category: "discount",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 2,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".1"),
+			},
+		},
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{
+				SKU:   "B1234",
+				Count: 3,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "A1234",
+				Count: 1,
+			},
+		},
+		{
+			Name:     "A coupon",
+			SKU:      "COUPON",
+			Category: "discount",
+			Code:     "save5",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".05"),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	errors := c.Update([]*store.Product{{SKU: "A1234", Count: 2}, {SKU: "B1234", Count: 1}})
+	if errors != nil {
+		t.Fatalf("Updating cart failed: %+v", errors)
+	}
+	view := c.View()
+	if view.Errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", view.Errors)
+	}
+	expectedApplied := []*store.PromotionExplanation{
+		{
+			SKU:         "DISCOUNT",
+			Name:        "A discount",
+			Category:    "discount",
+			Requirement: `2 x "A1234"`,
+			Qualifying:  2,
+			Saving:      money.MustParse("0.22"),
+		},
+	}
+	if !reflect.DeepEqual(view.Applied, expectedApplied) {
+		t.Errorf("Unexpected applied promotions. Expected %+v, got %+v.", expectedApplied[0], view.Applied)
+	}
+	expectedRejected := map[string]string{
+		"FREEBIE": "requirement not met",
+		"COUPON":  `coupon code "SAVE5" has not been applied`,
+	}
+	rejected := make(map[string]string)
+	for _, r := range view.Rejected {
+		rejected[r.SKU] = r.Reason
+		if r.SKU == "FREEBIE" && (r.Qualifying != 1 || r.Requirement != `3 x "B1234"`) {
+			t.Errorf("Unexpected explanation for freebie: %+v", r)
+		}
+	}
+	if !reflect.DeepEqual(rejected, expectedRejected) {
+		t.Errorf("Unexpected rejected promotions. Expected %+v, got %+v.", expectedRejected, rejected)
+	}
+}
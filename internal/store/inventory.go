@@ -2,49 +2,268 @@ package store
 
 import (
 	"fmt"
+	"github.com/golang/glog"
+	"github.com/jsfan/fake-shop/internal/money"
+	"net/url"
+	"strings"
 )
 
-var inventory map[string]*Product
-
 type Product struct {
 	SKU   string
 	Name  string
-	Price float64
+	Price money.Money
 	Count int `yaml:"stock"`
+	// LowStock is the stock level at or below which the product is shown as low in stock. Zero means never.
+	LowStock int `yaml:"lowStock"`
+	// Backorder products can still be added to carts when out of stock. Their stock goes negative by the number of
+	// items owed.
+	Backorder bool `yaml:"backorder"`
+	// Parent is the SKU of the product this is a variant of, e.g. a colour. Variants take the details they leave
+	// out from their parent.
+	Parent string `yaml:"parent"`
+	// Brand and Description are shown on the product page
+	Brand       string `yaml:"brand"`
+	Description string `yaml:"description"`
+	// Categories are the catalogue categories the product is listed in, e.g. "Electronics/Speakers"
+	Categories []string `yaml:"categories"`
+	// Images are the URLs of the product's images. The first is the main image.
+	Images []string `yaml:"images"`
+	// Attributes are free-form details such as colour or size
+	Attributes map[string]string `yaml:"attributes"`
+	// Tiers are volume price breaks applied automatically in carts
+	Tiers []PriceTier `yaml:"tiers"`
+	// Discontinued products are no longer sold but stay in the inventory for carts still holding them
+	Discontinued bool `yaml:"discontinued"`
+}
+
+// ProductUpdate lists changes to a product in the inventory. Fields left nil are not changed.
+type ProductUpdate struct {
+	Name        *string
+	Price       *money.Money
+	Tiers       *[]PriceTier
+	LowStock    *int
+	Backorder   *bool
+	Brand       *string
+	Description *string
+	Categories  *[]string
+	Images      *[]string
+	Attributes  *map[string]string
 }
 
 // StockShop takes an inventory and stocks the shop with it
-func StockShop(stock []*Product) error {
-	inventory = make(map[string]*Product, 0)
+func (s *Shop) StockShop(stock []*Product) error {
+	stock = ResolveVariants(stock)
+	stocked := make(map[string]*Product, 0)
+	currency := ""
 	for _, item := range stock {
-		if _, ok := inventory[item.SKU]; ok {
+		if _, ok := stocked[item.SKU]; ok {
 			return fmt.Errorf(`found duplicate SKU "%s"`, item.SKU)
 		}
-		inventory[item.SKU] = item
+		if currency == "" {
+			currency = item.Price.Currency
+		} else if item.Price.Currency != currency {
+			return fmt.Errorf(`SKU "%s" is priced in %s but the shop uses %s`, item.SKU, item.Price.Currency, currency)
+		}
+		if err := item.Validate(); err != nil {
+			return err
+		}
+		stocked[item.SKU] = item
+	}
+	if err := checkVariants(stocked); err != nil {
+		return err
+	}
+	return s.inventory.Replace(stock)
+}
+
+// Validate checks that a product in the inventory has a SKU, a price and a stock level which make sense
+func (p *Product) Validate() error {
+	if p.SKU == "" {
+		return fmt.Errorf(`product "%s" has no SKU`, p.Name)
+	}
+	if p.Price.Amount < 0 {
+		return fmt.Errorf(`negative price %s for SKU "%s"`, p.Price, p.SKU)
+	}
+	if p.Count < 0 && !p.Backorder {
+		return fmt.Errorf(`negative stock %d for SKU "%s"`, p.Count, p.SKU)
+	}
+	if p.LowStock < 0 {
+		return fmt.Errorf(`negative low-stock threshold %d for SKU "%s"`, p.LowStock, p.SKU)
+	}
+	if err := validateTiers(p.Tiers, p.Price.Currency); err != nil {
+		return fmt.Errorf(`invalid price tiers for SKU "%s": %w`, p.SKU, err)
+	}
+	for _, category := range p.Categories {
+		if strings.TrimSpace(category) == "" {
+			return fmt.Errorf(`empty category for SKU "%s"`, p.SKU)
+		}
+	}
+	for _, image := range p.Images {
+		if u, err := url.Parse(image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf(`invalid image URL "%s" for SKU "%s"`, image, p.SKU)
+		}
+	}
+	for name := range p.Attributes {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf(`attribute without name for SKU "%s"`, p.SKU)
+		}
+	}
+	return nil
+}
+
+// CreateProduct adds a new product to the inventory. A variant takes the details it leaves out from its parent.
+func (s *Shop) CreateProduct(product *Product) (*Product, error) {
+	created := *product
+	err := s.inventory.Update(func(products map[string]*Product) error {
+		if _, ok := products[product.SKU]; ok {
+			return fmt.Errorf(`SKU "%s" already exists`, product.SKU)
+		}
+		if err := checkVariant(products, &created); err != nil {
+			return err
+		}
+		if parent, ok := products[created.Parent]; ok {
+			resolveVariant(&created, parent)
+		}
+		if err := created.Validate(); err != nil {
+			return err
+		}
+		if err := checkCurrency(products, &created); err != nil {
+			return err
+		}
+		products[created.SKU] = &created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateProduct changes the price, price tiers, stock settings or catalogue details of a product in the inventory
+func (s *Shop) UpdateProduct(sku string, update ProductUpdate) (*Product, error) {
+	return s.changeProduct(sku, func(p *Product) error {
+		if update.Name != nil {
+			p.Name = *update.Name
+		}
+		if update.Price != nil {
+			p.Price = *update.Price
+		}
+		if update.Tiers != nil {
+			p.Tiers = *update.Tiers
+		}
+		if update.LowStock != nil {
+			p.LowStock = *update.LowStock
+		}
+		if update.Backorder != nil {
+			p.Backorder = *update.Backorder
+		}
+		if update.Brand != nil {
+			p.Brand = *update.Brand
+		}
+		if update.Description != nil {
+			p.Description = *update.Description
+		}
+		if update.Categories != nil {
+			p.Categories = *update.Categories
+		}
+		if update.Images != nil {
+			p.Images = *update.Images
+		}
+		if update.Attributes != nil {
+			p.Attributes = *update.Attributes
+		}
+		return nil
+	})
+}
+
+// Restock adds stock of a product to the inventory
+func (s *Shop) Restock(sku string, count int) (*Product, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf(`invalid count %d for SKU "%s"`, count, sku)
+	}
+	return s.changeProduct(sku, func(p *Product) error {
+		p.Count += count
+		return nil
+	})
+}
+
+// DiscontinueProduct stops selling a product. Carts holding the product keep it.
+func (s *Shop) DiscontinueProduct(sku string) (*Product, error) {
+	return s.changeProduct(sku, func(p *Product) error {
+		if p.Discontinued {
+			return fmt.Errorf(`SKU "%s" has already been discontinued`, sku)
+		}
+		p.Discontinued = true
+		return nil
+	})
+}
+
+// changeProduct applies a change to a product in the inventory and checks that the product is still valid. Its
+// variants are updated with the details they take from it.
+func (s *Shop) changeProduct(sku string, change func(p *Product) error) (*Product, error) {
+	var changed Product
+	err := s.inventory.Update(func(products map[string]*Product) error {
+		product, ok := products[sku]
+		if !ok {
+			return fmt.Errorf(`SKU "%s" does not exist`, sku)
+		}
+		changed = *product
+		if err := change(&changed); err != nil {
+			return err
+		}
+		if err := changed.Validate(); err != nil {
+			return err
+		}
+		if err := checkCurrency(products, &changed); err != nil {
+			return err
+		}
+		for variantSku, p := range products {
+			if p.Parent == sku { // variants take the details they took from the product as changed
+				variant := *p
+				reresolveVariant(&variant, product, &changed)
+				products[variantSku] = &variant
+			}
+		}
+		products[sku] = &changed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &changed, nil
+}
+
+// checkCurrency checks that a product is priced in the same currency as the other products in the inventory
+func checkCurrency(products map[string]*Product, product *Product) error {
+	for sku, other := range products {
+		if sku != product.SKU && other.Price.Currency != product.Price.Currency {
+			return fmt.Errorf(`SKU "%s" is priced in %s but the shop uses %s`, product.SKU, product.Price.Currency, other.Price.Currency)
+		}
 	}
 	return nil
 }
 
 // ClaimInventory claims stock from the inventory to add to a cart
-func ClaimInventory(product Product) (*Product, error) {
-	successfulClaim := product
-	if _, ok := inventory[product.SKU]; !ok {
-		successfulClaim.Count = 0
-		return nil, fmt.Errorf(`SKU "%s" does not exist`, product.SKU)
-	}
-	invProd := inventory[product.SKU]
-	invProd.Count -= product.Count
-	if invProd.Count < 0 {
-		successfulClaim.Count += inventory[product.SKU].Count
-		inventory[product.SKU].Count = 0
-		return &successfulClaim, fmt.Errorf(`not enough stock`)
-	}
-	successfulClaim.Name = invProd.Name
-	successfulClaim.Price = invProd.Price
-	return &successfulClaim, nil
-}
-
-// GetInventory returns the current inventory
-func GetInventory() map[string]*Product {
-	return inventory
+func (s *Shop) ClaimInventory(product Product) (*Product, error) {
+	if product.Count < 0 {
+		return nil, fmt.Errorf(`cannot claim negative count %d`, product.Count)
+	}
+	return s.inventory.Claim(product)
+}
+
+// GetInventory returns a snapshot of the current inventory
+func (s *Shop) GetInventory() map[string]*Product {
+	snapshot, err := s.inventory.All()
+	if err != nil {
+		glog.Errorf("Could not read inventory: %+v", err)
+		return make(map[string]*Product, 0)
+	}
+	return snapshot
+}
+
+// ReleaseInventory returns stock previously claimed by a cart to the inventory
+func (s *Shop) ReleaseInventory(product Product) error {
+	if product.Count < 0 {
+		return fmt.Errorf(`cannot release negative count %d`, product.Count)
+	}
+	return s.inventory.Release(product)
 }
@@ -1,44 +1,70 @@
 package store_test
 
 import (
+	"github.com/jsfan/fake-shop/internal/money"
 	"github.com/jsfan/fake-shop/internal/store"
 	"reflect"
 	"testing"
 )
 
 func TestStockShop(t *testing.T) {
+	shop := store.NewMemoryShop()
 	faultyStock := []*store.Product{
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 10,
 		},
 		{
 			SKU:   "A1234",
 			Name:  "Stick",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 5,
 		},
 	}
-	err := store.StockShop(faultyStock)
+	err := shop.StockShop(faultyStock)
 	if err == nil {
 		t.Fatal("Stocking shop didn't fail for duplicate SKU.")
 	}
+	faultyStock[1].SKU = "B1234"
+	faultyStock[1].Price = money.MustParse("0.1 EUR")
+	err = shop.StockShop(faultyStock)
+	if err == nil {
+		t.Fatal("Stocking shop didn't fail for mixed currencies.")
+	}
+	faultyStock[1].Price = money.MustParse("-0.1")
+	err = shop.StockShop(faultyStock)
+	if err == nil {
+		t.Fatal("Stocking shop didn't fail for a negative price.")
+	}
+	faultyStock[1].Price = money.MustParse("0.1")
+	faultyStock[1].Images = []string{"stick.jpg"}
+	err = shop.StockShop(faultyStock)
+	if err == nil {
+		t.Fatal("Stocking shop didn't fail for a relative image URL.")
+	}
+	faultyStock[1].Images = []string{"https://example.com/stick.jpg"}
+	faultyStock[1].Categories = []string{" "}
+	err = shop.StockShop(faultyStock)
+	if err == nil {
+		t.Fatal("Stocking shop didn't fail for an empty category.")
+	}
 }
 
 func TestGetInventory(t *testing.T) {
+	shop := store.NewMemoryShop()
 	loadedStock := []*store.Product{
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 10,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Stick",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 5,
 		},
 	}
@@ -46,28 +72,29 @@ func TestGetInventory(t *testing.T) {
 	for _, p := range loadedStock {
 		expectedStock[p.SKU] = p
 	}
-	err := store.StockShop(loadedStock)
+	err := shop.StockShop(loadedStock)
 	if err != nil {
 		t.Fatalf("Stocking shop failed: %+v", err)
 	}
-	stock := store.GetInventory()
+	stock := shop.GetInventory()
 	if !reflect.DeepEqual(stock, expectedStock) {
 		t.Fatalf("Stocking shop resulted in incorrect inventory. Expected %+v, got %+v.", expectedStock, stock)
 	}
 }
 
 func TestClaimInventory(t *testing.T) {
+	shop := store.NewMemoryShop()
 	initialStock := []*store.Product{
 		{
 			SKU:   "A1234",
 			Name:  "Carrot",
-			Price: 1.1,
+			Price: money.MustParse("1.1"),
 			Count: 10,
 		},
 		{
 			SKU:   "B1234",
 			Name:  "Stick",
-			Price: 0.1,
+			Price: money.MustParse("0.1"),
 			Count: 5,
 		},
 	}
@@ -75,13 +102,16 @@ func TestClaimInventory(t *testing.T) {
 	for _, p := range initialStock {
 		expectedStock[p.SKU] = p
 	}
+	if err := shop.StockShop(initialStock); err != nil {
+		t.Fatalf("Stocking shop failed: %+v", err)
+	}
 	toCart := store.Product{
 		SKU:   "A1234",
 		Name:  "Carrot",
-		Price: 1.1,
+		Price: money.MustParse("1.1"),
 		Count: 5,
 	}
-	actual, err := store.ClaimInventory(toCart)
+	actual, err := shop.ClaimInventory(toCart)
 	if err != nil {
 		t.Fatalf("Failed to claim existing stock: %+v", err)
 	}
@@ -89,3 +119,91 @@ func TestClaimInventory(t *testing.T) {
 		t.Errorf("Successful claim not as expected. Expected %+v, got %+v.", &toCart, actual)
 	}
 }
+
+func TestReleaseInventory(t *testing.T) {
+	shop := store.NewMemoryShop()
+	initialStock := []*store.Product{
+		{
+			SKU:   "A1234",
+			Name:  "Carrot",
+			Price: money.MustParse("1.1"),
+			Count: 10,
+		},
+	}
+	if err := shop.StockShop(initialStock); err != nil {
+		t.Fatalf("Stocking shop failed: %+v", err)
+	}
+	if _, err := shop.ClaimInventory(store.Product{SKU: "A1234", Count: 4}); err != nil {
+		t.Fatalf("Failed to claim existing stock: %+v", err)
+	}
+	if err := shop.ReleaseInventory(store.Product{SKU: "A1234", Count: 3}); err != nil {
+		t.Fatalf("Failed to release claimed stock: %+v", err)
+	}
+	if count := shop.GetInventory()["A1234"].Count; count != 9 {
+		t.Errorf("Stock not released. Expected 9, got %d.", count)
+	}
+	if err := shop.ReleaseInventory(store.Product{SKU: "B1234", Count: 1}); err == nil {
+		t.Error("Releasing stock for a non-existent SKU did not throw an error.")
+	}
+	if err := shop.ReleaseInventory(store.Product{SKU: "A1234", Count: -1}); err == nil {
+		t.Error("Releasing a negative count did not throw an error.")
+	}
+	if _, err := shop.ClaimInventory(store.Product{SKU: "A1234", Count: -1}); err == nil {
+		t.Error("Claiming a negative count did not throw an error.")
+	}
+}
+
+func TestShop_ManageProducts(t *testing.T) {
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	hat := &store.Product{SKU: "C1234", Name: "Hat", Price: money.MustParse("5"), Count: 1}
+	if _, err := shop.CreateProduct(hat); err != nil {
+		t.Fatalf("Creating product failed: %+v", err)
+	}
+	if _, err := shop.CreateProduct(hat); err == nil {
+		t.Error("Creating a duplicate product did not throw an error.")
+	}
+	if _, err := shop.CreateProduct(&store.Product{SKU: "D1234", Price: money.MustParse("5 EUR")}); err == nil {
+		t.Error("Creating a product in another currency did not throw an error.")
+	}
+	price := money.MustParse("4.5")
+	updated, err := shop.UpdateProduct("C1234", store.ProductUpdate{Price: &price})
+	if err != nil || updated.Price != price || updated.Name != "Hat" {
+		t.Errorf("Unexpected product after update: %+v (%+v)", updated, err)
+	}
+	negative := money.MustParse("-1")
+	if _, err := shop.UpdateProduct("C1234", store.ProductUpdate{Price: &negative}); err == nil {
+		t.Error("Updating to a negative price did not throw an error.")
+	}
+	if restocked, err := shop.Restock("C1234", 2); err != nil || restocked.Count != 3 {
+		t.Errorf("Unexpected product after restocking: %+v (%+v)", restocked, err)
+	}
+	if _, err := shop.Restock("C1234", 0); err == nil {
+		t.Error("Restocking nothing did not throw an error.")
+	}
+
+	_, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "C1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, err := shop.DiscontinueProduct("C1234"); err != nil {
+		t.Fatalf("Discontinuing product failed: %+v", err)
+	}
+	if err := cart.Add(&store.Product{SKU: "C1234", Count: 1}); err == nil {
+		t.Error("Adding a discontinued product to a cart did not throw an error.")
+	}
+	if errors := cart.Update([]*store.Product{{SKU: "C1234", Count: 1}}); errors != nil {
+		t.Errorf("Keeping a discontinued product in a cart failed: %+v", errors)
+	}
+	if errors := cart.Update([]*store.Product{{SKU: "C1234", Count: 2}}); errors == nil {
+		t.Error("Adding more of a discontinued product to a cart did not throw an error.")
+	}
+	if err := cart.Clear(); err != nil {
+		t.Fatalf("Clearing cart failed: %+v", err)
+	}
+	if inventory := shop.GetInventory(); inventory["C1234"].Count != 3 || !inventory["C1234"].Discontinued {
+		t.Errorf("Discontinued product not kept in the inventory: %+v", inventory["C1234"])
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import "strconv"
+
+// CartLine is a product in a cart. Lines keep the order in which their products were first added.
+type CartLine struct {
+	// ID identifies the line for as long as its product stays in the cart
+	ID      string
+	Product *Product
+	// Availability is how available the product is in the inventory
+	Availability Availability
+}
+
+// LineRef ties a cart line to the SKU of the product on it
+type LineRef struct {
+	ID  string
+	SKU string
+}
+
+// addLine adds a line for a product at the end of the cart unless it already has one. The caller must hold the
+// cart's lock.
+func (c *Cart) addLine(sku string) {
+	for _, line := range c.lines {
+		if line.SKU == sku {
+			return
+		}
+	}
+	c.nextLine++
+	c.lines = append(c.lines, LineRef{ID: strconv.Itoa(c.nextLine), SKU: sku})
+}
+
+// syncLines drops the lines of products no longer in the cart and adds lines for products without one in order of
+// SKU, e.g. for carts stored before lines were kept. The caller must hold the cart's lock.
+func (c *Cart) syncLines() {
+	lines := make([]LineRef, 0, len(c.contents))
+	for _, line := range c.lines {
+		if _, ok := c.contents[line.SKU]; ok {
+			lines = append(lines, line)
+		}
+	}
+	c.lines = lines
+	for _, sku := range sortedSKUs(c.contents) {
+		c.addLine(sku)
+	}
+}
+
+// cartLines lists copies of the products in the cart by line with their availability in the inventory. The caller
+// must hold the cart's lock.
+func (c *Cart) cartLines() []*CartLine {
+	c.syncLines()
+	var inventory map[string]*Product
+	if len(c.lines) > 0 {
+		inventory = c.shop.GetInventory()
+	}
+	lines := make([]*CartLine, 0, len(c.lines))
+	for _, line := range c.lines {
+		product := *c.contents[line.SKU]
+		availability := OutOfStock // no longer in the inventory
+		if stocked, ok := inventory[line.SKU]; ok {
+			availability = stocked.Availability()
+		}
+		lines = append(lines, &CartLine{ID: line.ID, Product: &product, Availability: availability})
+	}
+	return lines
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+)
+
+// MemoryInventory is an InventoryRepository which only lives as long as the process
+type MemoryInventory struct {
+	lock     sync.Mutex
+	products map[string]*Product
+}
+
+// MemoryPromotions is a PromotionRepository which only lives as long as the process
+type MemoryPromotions struct {
+	lock       sync.RWMutex
+	promotions []*Promotion
+	codeUses   map[string]int
+}
+
+// MemoryCarts is a CartRepository which only lives as long as the process
+type MemoryCarts struct {
+	lock  sync.RWMutex
+	carts map[uuid.UUID]*CartRecord
+}
+
+// MemoryOrders is an OrderRepository which only lives as long as the process
+type MemoryOrders struct {
+	lock   sync.RWMutex
+	orders []*Order
+}
+
+func NewMemoryInventory() *MemoryInventory {
+	return &MemoryInventory{
+		products: make(map[string]*Product, 0),
+	}
+}
+
+func NewMemoryPromotions() *MemoryPromotions {
+	return &MemoryPromotions{
+		codeUses: make(map[string]int),
+	}
+}
+
+func NewMemoryCarts() *MemoryCarts {
+	return &MemoryCarts{
+		carts: make(map[uuid.UUID]*CartRecord, 0),
+	}
+}
+
+func NewMemoryOrders() *MemoryOrders {
+	return &MemoryOrders{
+		orders: make([]*Order, 0),
+	}
+}
+
+func (i *MemoryInventory) Replace(stock []*Product) error {
+	products := make(map[string]*Product, len(stock))
+	for _, p := range stock {
+		prodCopy := *p
+		products[p.SKU] = &prodCopy
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.products = products
+	return nil
+}
+
+func (i *MemoryInventory) Claim(product Product) (*Product, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	invProd, ok := i.products[product.SKU]
+	if !ok {
+		return nil, fmt.Errorf(`SKU "%s" does not exist`, product.SKU)
+	}
+	return claimStock(invProd, product)
+}
+
+func (i *MemoryInventory) Release(product Product) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	invProd, ok := i.products[product.SKU]
+	if !ok {
+		return fmt.Errorf(`SKU "%s" does not exist`, product.SKU)
+	}
+	invProd.Count += product.Count
+	return nil
+}
+
+func (i *MemoryInventory) All() (map[string]*Product, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return copyProducts(i.products), nil
+}
+
+func (i *MemoryInventory) Update(change func(products map[string]*Product) error) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	products := copyProducts(i.products)
+	if err := change(products); err != nil {
+		return err
+	}
+	i.products = products
+	return nil
+}
+
+func (p *MemoryPromotions) Replace(promos []*Promotion) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.promotions = promos
+	return nil
+}
+
+func (p *MemoryPromotions) All() ([]*Promotion, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.promotions, nil
+}
+
+func (p *MemoryPromotions) ClaimCode(code string, limit int) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	uses, err := claimCode(p.codeUses[code], limit)
+	p.codeUses[code] = uses
+	return err
+}
+
+func (p *MemoryPromotions) ReleaseCode(code string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	uses, err := releaseCode(code, p.codeUses[code])
+	p.codeUses[code] = uses
+	return err
+}
+
+func (c *MemoryCarts) Put(cartId uuid.UUID, cart *CartRecord) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.carts[cartId] = cart
+	return nil
+}
+
+func (c *MemoryCarts) Delete(cartId uuid.UUID) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.carts, cartId)
+	return nil
+}
+
+func (c *MemoryCarts) All() (map[uuid.UUID]*CartRecord, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	all := make(map[uuid.UUID]*CartRecord, len(c.carts))
+	for id, cart := range c.carts {
+		all[id] = cart
+	}
+	return all, nil
+}
+
+func (o *MemoryOrders) Put(order *Order) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.orders = append(o.orders, order.copy())
+	return nil
+}
+
+func (o *MemoryOrders) All() ([]*Order, error) {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	all := make([]*Order, 0, len(o.orders))
+	for _, order := range o.orders {
+		all = append(all, order.copy())
+	}
+	return all, nil
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/money"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Order is the frozen result of checking out a cart. It is never modified after checkout.
+type Order struct {
+	ID             uuid.UUID
+	Items          []*Product
+	PromotionItems []*Product
+	Subtotal       money.Money
+	Total          money.Money
+	Placed         time.Time
+}
+
+// Checkout turns a cart into an order. The stock claimed by the cart is committed and the cart is deleted.
+func (s *Shop) Checkout(cartId uuid.UUID) (*Order, error) {
+	s.cartsLock.Lock()
+	defer s.cartsLock.Unlock()
+	cart, exists := s.carts[cartId]
+	if !exists {
+		return nil, errors.New("cart does not exist")
+	}
+	order, err := cart.checkout(s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	delete(s.carts, cartId)
+	s.ordersLock.Lock()
+	defer s.ordersLock.Unlock()
+	s.orders[order.ID] = order
+	if err := s.orderRepository.Put(order); err != nil { // the stock has already been committed
+		glog.Errorf("Could not store order %s: %+v", order.ID, err)
+	}
+	return order.copy(), nil
+}
+
+// checkout freezes the cart's contents with promotions applied into an order and marks the cart as released
+// without returning its stock to the inventory
+func (c *Cart) checkout(now time.Time) (*Order, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.released || !now.Before(c.expires) {
+		return nil, errCartExpired
+	}
+	view := c.get()
+	cartItems, promoItems := view.Items, view.PromotionItems
+	if len(cartItems) == 0 {
+		return nil, errors.New("cart is empty")
+	}
+	if len(view.Errors) > 0 {
+		return nil, refuseCheckout(view.Errors)
+	}
+	promos, err := c.shop.promotions.All()
+	if err != nil {
+		return nil, fmt.Errorf(`internal error: %w`, err)
+	}
+	usedCoupons, couponErrors := c.checkCoupons(promos, now)
+	if len(couponErrors) > 0 { // a coupon ran out since the cart was priced
+		return nil, refuseCheckout(couponErrors)
+	}
+	c.releaseCoupons(usedCoupons)
+	order := &Order{
+		ID:             uuid.New(),
+		Items:          sortedProducts(cartItems),
+		PromotionItems: sortedProducts(promoItems),
+		Subtotal:       TotalPrice(cartItems),
+		Total:          TotalPrice(cartItems, promoItems),
+		Placed:         now,
+	}
+	c.contents = nil
+	c.promoCache = nil
+	c.released = true
+	c.forget()
+	c.shop.publishCartEvent(CartEvent{
+		CartID:  c.id,
+		Kind:    CartCheckedOut,
+		Expires: c.expires,
+	})
+	return order, nil
+}
+
+// refuseCheckout turns the problems found with a cart into the error refusing its checkout
+func refuseCheckout(problems []error) error {
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	return fmt.Errorf(`cart cannot be checked out: %s`, strings.Join(messages, "; "))
+}
+
+// GetOrder retrieves an order by its ID
+func (s *Shop) GetOrder(orderId uuid.UUID) (*Order, bool) {
+	s.ordersLock.RLock()
+	defer s.ordersLock.RUnlock()
+	order, ok := s.orders[orderId]
+	if !ok {
+		return nil, false
+	}
+	return order.copy(), true
+}
+
+// GetOrders retrieves all orders in the order they were placed
+func (s *Shop) GetOrders() []*Order {
+	s.ordersLock.RLock()
+	defer s.ordersLock.RUnlock()
+	allOrders := make([]*Order, 0, len(s.orders))
+	for _, order := range s.orders {
+		allOrders = append(allOrders, order.copy())
+	}
+	sort.Slice(allOrders, func(i, j int) bool {
+		return allOrders[i].Placed.Before(allOrders[j].Placed)
+	})
+	return allOrders
+}
+
+// copy creates a deep copy of an order so that the stored order cannot be modified
+func (o *Order) copy() *Order {
+	orderCopy := *o
+	orderCopy.Items = copyProductList(o.Items)
+	orderCopy.PromotionItems = copyProductList(o.PromotionItems)
+	return &orderCopy
+}
+
+func copyProductList(products []*Product) []*Product {
+	productsCopy := make([]*Product, 0, len(products))
+	for _, p := range products {
+		prodCopy := *p
+		productsCopy = append(productsCopy, &prodCopy)
+	}
+	return productsCopy
+}
+
+// sortedProducts lists products by SKU
+func sortedProducts(products map[string]*Product) []*Product {
+	sorted := make([]*Product, 0, len(products))
+	for _, p := range products {
+		prodCopy := *p
+		sorted = append(sorted, &prodCopy)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].SKU < sorted[j].SKU
+	})
+	return sorted
+}
@@ -0,0 +1,172 @@
+package store_test
+
+import (
+	"github.com/google/uuid"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"testing"
+)
+
+func TestCheckout(t *testing.T) {
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A discount",
+			SKU:      "DISCOUNT",
+			Category: "discount",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 2,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".5"),
+			},
+		},
+	})
+
+	if _, err := shop.Checkout(uuid.New()); err == nil {
+		t.Error("Checking out a non-existent cart did not throw an error.")
+	}
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	if _, err := shop.Checkout(cartId); err == nil {
+		t.Error("Checking out an empty cart did not throw an error.")
+	}
+	errors := cart.Update([]*store.Product{
+		{
+			SKU:   "A1234",
+			Count: 2,
+		},
+		{
+			SKU:   "B1234",
+			Count: 1,
+		},
+	})
+	if errors != nil {
+		t.Fatalf("Updating cart failed unexpectedly: %+v", errors)
+	}
+	events, unsubscribe := shop.SubscribeCartEvents(cartId)
+	defer unsubscribe()
+
+	order, err := shop.Checkout(cartId)
+	if err != nil {
+		t.Fatalf("Checkout failed: %+v", err)
+	}
+	if len(order.Items) != 2 || order.Items[0].SKU != "A1234" || order.Items[1].SKU != "B1234" {
+		t.Errorf("Unexpected order items: %+v", order.Items)
+	}
+	if len(order.PromotionItems) != 1 || order.PromotionItems[0].SKU != "DISCOUNT" {
+		t.Errorf("Unexpected promotion items: %+v", order.PromotionItems)
+	}
+	if order.Subtotal != money.MustParse("2.3") || order.Total != money.MustParse("1.2") {
+		t.Errorf("Unexpected order totals. Expected 2.30 USD and 1.20 USD, got %s and %s.", order.Subtotal, order.Total)
+	}
+	expectEvent(t, events, store.CartCheckedOut)
+
+	if shop.CartExists(cartId) {
+		t.Error("Cart still exists after checkout.")
+	}
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 1}); err == nil {
+		t.Error("Adding to a checked out cart did not throw an error.")
+	}
+	inventory := shop.GetInventory()
+	if inventory["A1234"].Count != 8 || inventory["B1234"].Count != 4 {
+		t.Errorf("Stock not committed on checkout: %+v, %+v", inventory["A1234"], inventory["B1234"])
+	}
+
+	stored, ok := shop.GetOrder(order.ID)
+	if !ok {
+		t.Fatal("Order not found after checkout.")
+	}
+	stored.Items[0].Count = 100
+	if stored, _ = shop.GetOrder(order.ID); stored.Items[0].Count != 2 {
+		t.Error("Stored order was modified through a retrieved copy.")
+	}
+	if allOrders := shop.GetOrders(); len(allOrders) != 1 || allOrders[0].ID != order.ID {
+		t.Errorf("Unexpected orders: %+v", allOrders)
+	}
+	if _, ok := shop.GetOrder(uuid.New()); ok {
+		t.Error("Found an order which was never placed.")
+	}
+}
+
+func TestCheckout_RefusedWithErrors(t *testing.T) {
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A free stick with every carrot",
+			SKU:      "FREESTICK",
+			Category: "freebie",
+			Requires: store.Requirement{SKU: "A1234", Count: 1},
+			Rule:     store.RuleDetail{SKU: "B1234", Count: 1},
+		},
+	})
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 6}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, err := shop.Checkout(cartId); err == nil {
+		t.Error("Checking out a cart whose freebies ran out of stock did not throw an error.")
+	}
+	if !shop.CartExists(cartId) {
+		t.Error("Cart deleted although checkout was refused.")
+	}
+	if len(shop.GetOrders()) != 0 {
+		t.Errorf("Order placed although checkout was refused: %+v", shop.GetOrders())
+	}
+
+	if errors := cart.Update([]*store.Product{{SKU: "A1234", Count: 5}}); errors != nil {
+		t.Fatalf("Updating cart failed: %+v", errors)
+	}
+	if _, err := shop.Checkout(cartId); err != nil {
+		t.Errorf("Checkout failed once the cart had no problems: %+v", err)
+	}
+}
+
+func TestCheckout_DiscontinuedReward(t *testing.T) {
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A free stick with every carrot",
+			SKU:      "FREESTICK",
+			Category: "freebie",
+			Requires: store.Requirement{SKU: "A1234", Count: 1},
+			Rule:     store.RuleDetail{SKU: "B1234", Count: 1},
+		},
+	})
+	cartId := uuid.New()
+	_, cart := shop.RetrieveCart(&cartId)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	cart.Get() // claims the freebie
+	if _, err := shop.DiscontinueProduct("B1234"); err != nil {
+		t.Fatalf("Discontinuing product failed: %+v", err)
+	}
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	view := cart.View()
+	if view.Errors != nil {
+		t.Errorf("Discontinued freebie reported as a cart error: %+v", view.Errors)
+	}
+	if len(view.Rejected) != 1 || view.Rejected[0].Reason != `SKU "B1234" has been discontinued` {
+		t.Errorf("Discontinued freebie not rejected: %+v", view.Rejected)
+	}
+	if stick := shop.GetInventory()["B1234"]; stick.Count != 5 {
+		t.Errorf("Freebie stock not released. Expected 5 sticks, got %d.", stick.Count)
+	}
+	if _, err := shop.Checkout(cartId); err != nil {
+		t.Errorf("Checkout failed because a freebie was discontinued: %+v", err)
+	}
+}
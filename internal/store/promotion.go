@@ -1,31 +1,299 @@
 package store
 
-import "fmt"
-
-var promotions []*Promotion
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/jsfan/fake-shop/internal/money"
+	"time"
+)
 
 type Requirement struct {
-	SKU   string
-	Count int
+	SKU   string `yaml:"sku,omitempty"`
+	Count int    `yaml:"count,omitempty"`
+	// MinSpend is the subtotal a cart must reach for a cart promotion
+	MinSpend money.Money `yaml:"minSpend,omitempty"`
 }
 
 type RuleDetail struct {
-	SKU      string
-	Count    int
-	Discount float64
+	SKU      string     `yaml:"sku,omitempty"`
+	Count    int        `yaml:"count,omitempty"`
+	Discount money.Rate `yaml:"discount,omitempty"`
+	// Amount is a fixed amount taken off by a cart promotion
+	Amount money.Money `yaml:"amount,omitempty"`
+	// Price is the price of a complete bundle
+	Price money.Money `yaml:"price,omitempty"`
+	// MaxRewards limits the reward items a cart gets from a buy X get Y promotion. Zero means unlimited.
+	MaxRewards int `yaml:"maxRewards,omitempty"`
 }
 
 type Promotion struct {
 	Name     string
 	SKU      string
 	Category string
-	Requires Requirement `yaml:"requires"`
-	Rule     RuleDetail  `yaml:"rule"`
+	// Disabled promotions are kept but never applied
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Code restricts the promotion to carts the coupon code has been applied to
+	Code string `yaml:"code,omitempty"`
+	// MaxUses limits how often the coupon code can be used. Zero means unlimited.
+	MaxUses int `yaml:"maxUses,omitempty"`
+	// CodeExpires is the time from which the coupon code can no longer be used. Zero means never.
+	CodeExpires time.Time `yaml:"codeExpires,omitempty"`
+	// ValidFrom is the time the promotion starts. Zero means it has always run.
+	ValidFrom time.Time `yaml:"validFrom,omitempty"`
+	// ValidUntil is the time the promotion ends. Zero means it never ends.
+	ValidUntil time.Time `yaml:"validUntil,omitempty"`
+	// Schedule optionally restricts the promotion to recurring windows between ValidFrom and ValidUntil
+	Schedule *Schedule `yaml:"schedule,omitempty"`
+	// Priority orders conflicting promotions. Promotions with a higher priority are considered first.
+	Priority int `yaml:"priority,omitempty"`
+	// Group names an exclusivity group. Only one promotion of a group applies to a cart.
+	Group string `yaml:"group,omitempty"`
+	// Stackable promotions can apply to the same products as other stackable promotions
+	Stackable bool        `yaml:"stackable,omitempty"`
+	Requires  Requirement `yaml:"requires,omitempty"`
+	// Bundle lists the products making up one bundle for a bundle promotion
+	Bundle []Requirement `yaml:"bundle,omitempty"`
+	// Tiers are the volume price breaks of a tiered promotion
+	Tiers []PriceTier `yaml:"tiers,omitempty"`
+	Rule  RuleDetail  `yaml:"rule,omitempty"`
 }
 
 // RegisterPromotions takes a list of promotions and registers them for use
-func RegisterPromotions(promos []*Promotion) {
-	promotions = promos
+func (s *Shop) RegisterPromotions(promos []*Promotion) error {
+	if err := ValidatePromotions(promos); err != nil {
+		return err
+	}
+	s.promotionsLock.Lock()
+	defer s.promotionsLock.Unlock()
+	return s.promotions.Replace(promos)
+}
+
+// Promotions returns the registered promotions in the order they were registered
+func (s *Shop) Promotions() []*Promotion {
+	promos, err := s.promotions.All()
+	if err != nil {
+		glog.Errorf("Could not read promotions: %+v", err)
+		return make([]*Promotion, 0)
+	}
+	return promos
+}
+
+// ActivePromotions returns the promotions running now which do not need a coupon code
+func (s *Shop) ActivePromotions() []*Promotion {
+	now := s.clock.Now()
+	active := make([]*Promotion, 0)
+	for _, p := range s.Promotions() {
+		if p.Code == "" && p.activeAt(now) {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+// CreatePromotion registers a new promotion after the existing ones
+func (s *Shop) CreatePromotion(promo *Promotion) error {
+	if err := s.checkStocked(promo); err != nil {
+		return err
+	}
+	return s.changePromotions(func(promos []*Promotion) ([]*Promotion, error) {
+		return append(promos, promo), nil
+	})
+}
+
+// UpdatePromotion replaces the promotion with the given SKU. The new version keeps its position.
+func (s *Shop) UpdatePromotion(sku string, promo *Promotion) error {
+	if err := s.checkStocked(promo); err != nil {
+		return err
+	}
+	return s.changePromotions(func(promos []*Promotion) ([]*Promotion, error) {
+		i, err := findPromotion(promos, sku)
+		if err != nil {
+			return nil, err
+		}
+		promos[i] = promo
+		return promos, nil
+	})
+}
+
+// EnablePromotion enables or disables the promotion with the given SKU
+func (s *Shop) EnablePromotion(sku string, enabled bool) (*Promotion, error) {
+	var changed *Promotion
+	err := s.changePromotions(func(promos []*Promotion) ([]*Promotion, error) {
+		i, err := findPromotion(promos, sku)
+		if err != nil {
+			return nil, err
+		}
+		promoCopy := *promos[i] // carts may be reading the registered promotion
+		promoCopy.Disabled = !enabled
+		promos[i] = &promoCopy
+		changed = &promoCopy
+		return promos, nil
+	})
+	return changed, err
+}
+
+// DeletePromotion removes the promotion with the given SKU
+func (s *Shop) DeletePromotion(sku string) (*Promotion, error) {
+	var deleted *Promotion
+	err := s.changePromotions(func(promos []*Promotion) ([]*Promotion, error) {
+		i, err := findPromotion(promos, sku)
+		if err != nil {
+			return nil, err
+		}
+		deleted = promos[i]
+		return append(promos[:i], promos[i+1:]...), nil
+	})
+	return deleted, err
+}
+
+// changePromotions applies a change to a copy of the list of promotions and registers the result
+func (s *Shop) changePromotions(change func(promos []*Promotion) ([]*Promotion, error)) error {
+	s.promotionsLock.Lock()
+	defer s.promotionsLock.Unlock()
+	current, err := s.promotions.All()
+	if err != nil {
+		return err
+	}
+	promos, err := change(append([]*Promotion{}, current...))
+	if err != nil {
+		return err
+	}
+	if err := ValidatePromotions(promos); err != nil {
+		return err
+	}
+	return s.promotions.Replace(promos)
+}
+
+// findPromotion finds the position of a promotion by its SKU
+func findPromotion(promos []*Promotion, sku string) (int, error) {
+	for i, p := range promos {
+		if p.SKU == sku {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf(`promotion "%s" does not exist`, sku)
+}
+
+// checkStocked checks that the products a promotion refers to are in the inventory and that its amounts are in the
+// currency the products are priced in
+func (s *Shop) checkStocked(promo *Promotion) error {
+	inventory := s.GetInventory()
+	if promo.Requires.SKU != "" && inventory[promo.Requires.SKU] == nil {
+		return fmt.Errorf(`promotion "%s" requires SKU "%s" which is not in stock`, promo.SKU, promo.Requires.SKU)
+	}
+	if promo.Rule.SKU != "" && inventory[promo.Rule.SKU] == nil {
+		return fmt.Errorf(`promotion "%s" rewards SKU "%s" which is not in stock`, promo.SKU, promo.Rule.SKU)
+	}
+	for _, item := range promo.Bundle {
+		if inventory[item.SKU] == nil {
+			return fmt.Errorf(`bundle promotion "%s" includes SKU "%s" which is not in stock`, promo.SKU, item.SKU)
+		}
+	}
+	for _, p := range inventory {
+		return promo.checkCurrency(p.Price.Currency) // all products are priced in the same currency
+	}
+	return nil
+}
+
+// checkCurrency checks that the amounts of a promotion are in the shop's currency
+func (p *Promotion) checkCurrency(currency string) error {
+	amounts := []money.Money{p.Requires.MinSpend, p.Rule.Amount, p.Rule.Price}
+	for _, tier := range p.Tiers {
+		amounts = append(amounts, tier.Price)
+	}
+	for _, amount := range amounts {
+		if !amount.IsZero() && amount.Currency != currency {
+			return fmt.Errorf(`promotion "%s" is in %s but the shop uses %s`, p.SKU, amount.Currency, currency)
+		}
+	}
+	return nil
+}
+
+// ValidatePromotions checks that a list of promotions can be registered
+func ValidatePromotions(promos []*Promotion) error {
+	skus := make(map[string]bool, len(promos))
+	codes := make(map[string]bool)
+	for _, p := range promos {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if skus[p.SKU] {
+			return fmt.Errorf(`duplicate promotion SKU "%s"`, p.SKU)
+		}
+		skus[p.SKU] = true
+		if p.Code == "" {
+			continue
+		}
+		code := normaliseCode(p.Code)
+		if codes[code] {
+			return fmt.Errorf(`duplicate coupon code "%s"`, code)
+		}
+		codes[code] = true
+	}
+	return nil
+}
+
+// Validate checks that a promotion is complete and can be applied without failing
+func (p *Promotion) Validate() error {
+	if p.SKU == "" {
+		return fmt.Errorf(`promotion "%s" has no SKU`, p.Name)
+	}
+	if !p.ValidFrom.IsZero() && !p.ValidUntil.IsZero() && !p.ValidUntil.After(p.ValidFrom) {
+		return fmt.Errorf(`promotion "%s" ends before it starts`, p.SKU)
+	}
+	if p.Schedule != nil {
+		if err := p.Schedule.validate(); err != nil {
+			return fmt.Errorf(`invalid schedule for promotion "%s": %w`, p.SKU, err)
+		}
+	}
+	if p.MaxUses < 0 {
+		return fmt.Errorf(`invalid usage limit %d for coupon code "%s"`, p.MaxUses, normaliseCode(p.Code))
+	}
+	switch p.Category {
+	case "freebie", "n4m", "discount", "bxgy", "tiered":
+		if p.Requires.SKU == "" {
+			return fmt.Errorf(`promotion "%s" does not require a SKU`, p.SKU)
+		}
+		if p.Requires.Count <= 0 && p.Category != "tiered" {
+			return fmt.Errorf(`promotion "%s" requires invalid count %d`, p.SKU, p.Requires.Count)
+		}
+	}
+	switch p.Category {
+	case "freebie":
+		if p.Rule.SKU == "" || p.Rule.Count <= 0 {
+			return fmt.Errorf(`freebie promotion "%s" needs a SKU and a positive count to give away`, p.SKU)
+		}
+	case "n4m":
+		if p.Rule.Count <= 0 || p.Rule.Count >= p.Requires.Count {
+			return fmt.Errorf(`promotion "%s" must charge for between 1 and %d items`, p.SKU, p.Requires.Count-1)
+		}
+	case "discount":
+		if p.Rule.Discount <= 0 || p.Rule.Discount > money.RateScale {
+			return fmt.Errorf(`invalid discount %s for promotion "%s"`, p.Rule.Discount, p.SKU)
+		}
+	case "cart":
+		if err := p.validateCart(); err != nil {
+			return fmt.Errorf(`invalid cart promotion "%s": %w`, p.SKU, err)
+		}
+	case "bundle":
+		if err := p.validateBundle(); err != nil {
+			return fmt.Errorf(`invalid bundle promotion "%s": %w`, p.SKU, err)
+		}
+	case "bxgy":
+		if err := p.validateBuyGet(); err != nil {
+			return fmt.Errorf(`invalid buy X get Y promotion "%s": %w`, p.SKU, err)
+		}
+	case "tiered":
+		if len(p.Tiers) == 0 {
+			return fmt.Errorf(`tiered promotion "%s" has no tiers`, p.SKU)
+		}
+		if err := validateTiers(p.Tiers, ""); err != nil {
+			return fmt.Errorf(`invalid tiered promotion "%s": %w`, p.SKU, err)
+		}
+	default:
+		return fmt.Errorf(`unknown category "%s" for promotion "%s"`, p.Category, p.SKU)
+	}
+	return nil
 }
 
 // Apply applies a promotion to a product
@@ -37,22 +305,22 @@ func (p *Promotion) Apply(product *Product) (claimsItem *Product, promoItem *Pro
 			return &Product{
 					SKU:   p.Rule.SKU,
 					Name:  "", // filled later by cart using SKU
-					Price: 0,
+					Price: product.Price.Zero(),
 					Count: freebieCount,
 				},
 				&Product{
 					SKU:   p.SKU,
 					Name:  p.Name,
-					Price: 0,
+					Price: product.Price.Zero(),
 					Count: freebieCount,
 				},
 				nil
 		case "n4m":
-			freeItemCount := product.Count/p.Requires.Count*p.Requires.Count - p.Rule.Count
+			freeItemCount := product.Count / p.Requires.Count * (p.Requires.Count - p.Rule.Count)
 			return nil, &Product{
 				SKU:   p.SKU,
 				Name:  p.Name,
-				Price: -product.Price,
+				Price: product.Price.Neg(),
 				Count: freeItemCount,
 			}, nil
 		case "discount":
@@ -60,13 +328,200 @@ func (p *Promotion) Apply(product *Product) (claimsItem *Product, promoItem *Pro
 				return nil, &Product{
 					SKU:   p.SKU,
 					Name:  p.Name,
-					Price: -p.Rule.Discount * product.Price,
+					Price: product.Price.Percent(p.Rule.Discount).Neg(), // rounded per unit
 					Count: product.Count,
 				}, nil
 			}
+		case "bxgy":
+			rewards := product.Count / p.Requires.Count * p.Rule.Count
+			if p.Rule.MaxRewards > 0 && rewards > p.Rule.MaxRewards {
+				rewards = p.Rule.MaxRewards
+			}
+			return &Product{
+					SKU:   p.Rule.SKU,
+					Name:  "", // filled later by cart using SKU
+					Price: product.Price.Zero(),
+					Count: rewards,
+				},
+				&Product{
+					SKU:   p.SKU,
+					Name:  p.Name,
+					Price: product.Price.Zero(), // priced by the cart once the reward is claimed
+					Count: rewards,
+				},
+				nil
+		case "tiered":
+			extra, err := p.applyTiers(product)
+			if err != nil || extra != nil {
+				return nil, extra, err
+			}
+		case "cart", "bundle": // applied to the whole cart by ApplyCart
 		default:
 			return product, nil, fmt.Errorf(`unknown promotion "%s"`, p.Category)
 		}
 	}
 	return nil, nil, nil
 }
+
+// validateCart checks that a cart promotion takes off either a percentage or a fixed amount
+func (p *Promotion) validateCart() error {
+	if p.Requires.MinSpend.Amount < 0 || p.Rule.Amount.Amount < 0 || p.Rule.Discount < 0 {
+		return fmt.Errorf(`amounts must not be negative`)
+	}
+	if (p.Rule.Discount == 0) == p.Rule.Amount.IsZero() {
+		return fmt.Errorf(`exactly one of discount and amount must be set`)
+	}
+	return nil
+}
+
+// validateBuyGet checks that a buy X get Y promotion names its reward and takes off either a percentage or a
+// fixed amount
+func (p *Promotion) validateBuyGet() error {
+	if p.Requires.Count <= 0 || p.Rule.Count <= 0 {
+		return fmt.Errorf(`counts must be positive`)
+	}
+	if p.Rule.SKU == "" {
+		return fmt.Errorf(`no reward SKU`)
+	}
+	if p.Rule.MaxRewards < 0 {
+		return fmt.Errorf(`invalid maximum rewards %d`, p.Rule.MaxRewards)
+	}
+	if p.Rule.Discount < 0 || p.Rule.Discount > money.RateScale || p.Rule.Amount.Amount < 0 {
+		return fmt.Errorf(`invalid discount`)
+	}
+	if (p.Rule.Discount == 0) == p.Rule.Amount.IsZero() {
+		return fmt.Errorf(`exactly one of discount and amount must be set`)
+	}
+	return nil
+}
+
+// rewardPrice works out the price of a reward item of a buy X get Y promotion from its list price
+func (p *Promotion) rewardPrice(list money.Money) (money.Money, error) {
+	off := list.Percent(p.Rule.Discount)
+	if !p.Rule.Amount.IsZero() {
+		if p.Rule.Amount.Currency != list.Currency {
+			return list, fmt.Errorf(`promotion "%s" is in %s but the reward is priced in %s`, p.SKU, p.Rule.Amount.Currency, list.Currency)
+		}
+		off = p.Rule.Amount
+	}
+	if off.Cmp(list) > 0 {
+		return list.Zero(), nil
+	}
+	return list.Sub(off), nil
+}
+
+// validateBundle checks that a bundle promotion lists distinct products and either a price or a discount
+func (p *Promotion) validateBundle() error {
+	if len(p.Bundle) == 0 {
+		return fmt.Errorf(`bundle lists no products`)
+	}
+	seen := make(map[string]bool, len(p.Bundle))
+	for _, item := range p.Bundle {
+		if item.SKU == "" {
+			return fmt.Errorf(`bundle product without SKU`)
+		}
+		if seen[item.SKU] {
+			return fmt.Errorf(`SKU "%s" listed twice`, item.SKU)
+		}
+		if item.Count <= 0 {
+			return fmt.Errorf(`invalid count %d for SKU "%s"`, item.Count, item.SKU)
+		}
+		seen[item.SKU] = true
+	}
+	if p.Rule.Price.Amount < 0 || p.Rule.Discount < 0 {
+		return fmt.Errorf(`price and discount must not be negative`)
+	}
+	if p.Rule.Discount > money.RateScale {
+		return fmt.Errorf(`invalid discount`)
+	}
+	if (p.Rule.Discount == 0) == p.Rule.Price.IsZero() {
+		return fmt.Errorf(`exactly one of price and discount must be set`)
+	}
+	return nil
+}
+
+// ApplyCart applies a promotion which looks at all products in a cart at once. If the cart qualifies, the
+// discount is returned as a single promotion item.
+func (p *Promotion) ApplyCart(contents map[string]*Product) (promoItem *Product, err error) {
+	if len(contents) == 0 {
+		return nil, nil
+	}
+	switch p.Category {
+	case "cart":
+		return p.applyThreshold(contents)
+	case "bundle":
+		return p.applyBundle(contents)
+	}
+	return nil, nil
+}
+
+// applyThreshold takes a percentage or fixed amount off the subtotal of a cart which reaches the promotion's
+// spend or item count
+func (p *Promotion) applyThreshold(contents map[string]*Product) (*Product, error) {
+	subtotal := TotalPrice(contents)
+	count := 0
+	for _, product := range contents {
+		if p.Requires.SKU == "" || product.SKU == p.Requires.SKU || product.Parent == p.Requires.SKU {
+			count += product.Count
+		}
+	}
+	for _, amount := range []money.Money{p.Requires.MinSpend, p.Rule.Amount} {
+		if !amount.IsZero() && amount.Currency != subtotal.Currency {
+			return nil, fmt.Errorf(`promotion "%s" is in %s but the cart is in %s`, p.SKU, amount.Currency, subtotal.Currency)
+		}
+	}
+	if count == 0 || count < p.Requires.Count || subtotal.Cmp(p.Requires.MinSpend) < 0 {
+		return nil, nil
+	}
+	off := p.Rule.Amount
+	if p.Rule.Discount != 0 {
+		off = subtotal.Percent(p.Rule.Discount)
+	}
+	if off.Cmp(subtotal) > 0 { // never pay customers for their order
+		off = subtotal
+	}
+	return &Product{
+		SKU:   p.SKU,
+		Name:  p.Name,
+		Price: off.Neg(),
+		Count: 1,
+	}, nil
+}
+
+// applyBundle discounts as many complete bundles as the cart contains
+func (p *Promotion) applyBundle(contents map[string]*Product) (*Product, error) {
+	bundles := -1
+	bundlePrice := money.Money{}
+	for _, item := range p.Bundle {
+		product, ok := contents[item.SKU]
+		if !ok || item.Count <= 0 {
+			return nil, nil
+		}
+		if fits := product.Count / item.Count; bundles < 0 || fits < bundles {
+			bundles = fits
+		}
+		bundlePrice = bundlePrice.Add(product.Price.Mul(int64(item.Count)))
+	}
+	if bundles <= 0 {
+		return nil, nil
+	}
+	off := bundlePrice.Percent(p.Rule.Discount)
+	if !p.Rule.Price.IsZero() {
+		if p.Rule.Price.Currency != bundlePrice.Currency {
+			return nil, fmt.Errorf(`promotion "%s" is in %s but the cart is in %s`, p.SKU, p.Rule.Price.Currency, bundlePrice.Currency)
+		}
+		off = bundlePrice.Sub(p.Rule.Price)
+	}
+	if off.Cmp(off.Zero()) <= 0 { // the bundle would cost more than its products
+		return nil, nil
+	}
+	if off.Cmp(bundlePrice) > 0 { // never pay customers for their order
+		off = bundlePrice
+	}
+	return &Product{
+		SKU:   p.SKU,
+		Name:  p.Name,
+		Price: off.Neg(),
+		Count: bundles,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package store_test
 
 import (
+	"github.com/jsfan/fake-shop/internal/money"
 	"github.com/jsfan/fake-shop/internal/store"
 	"reflect"
 	"testing"
@@ -24,7 +25,7 @@ func TestPromotion_ApplyFreebie(t *testing.T) {
 	prod := &store.Product{
 		SKU:   "12345678",
 		Name:  "Test",
-		Price: 11.5,
+		Price: money.MustParse("11.5"),
 		Count: 2,
 	}
 	claims, promoItems, err := promo.Apply(prod)
@@ -40,19 +41,19 @@ func TestPromotion_ApplyFreebie(t *testing.T) {
 	prod = &store.Product{
 		SKU:   "ABC123",
 		Name:  "Test",
-		Price: 11.5,
+		Price: money.MustParse("11.5"),
 		Count: 2,
 	}
 	expectedClaims := &store.Product{
 		SKU:   "DEF567",
 		Name:  "",
-		Price: 0,
+		Price: money.MustParse("0"),
 		Count: 2,
 	}
 	expectedPromoItems := &store.Product{
 		SKU:   "FREEBIE",
 		Name:  "A freebie",
-		Price: 0,
+		Price: money.MustParse("0"),
 		Count: 2,
 	}
 	claims, promoItems, err = promo.Apply(prod)
@@ -77,13 +78,13 @@ func TestPromotion_ApplyDiscount(t *testing.T) {
 			Count: 10,
 		},
 		Rule: store.RuleDetail{
-			Discount: .3,
+			Discount: money.MustParseRate(".3"),
 		},
 	}
 	prod := &store.Product{
 		SKU:   "12345678",
 		Name:  "Test",
-		Price: 11.5,
+		Price: money.MustParse("11.5"),
 		Count: 2,
 	}
 	claims, promoItems, err := promo.Apply(prod)
@@ -99,7 +100,7 @@ func TestPromotion_ApplyDiscount(t *testing.T) {
 	prod = &store.Product{
 		SKU:   "ABC123",
 		Name:  "Test",
-		Price: 15.,
+		Price: money.MustParse("15."),
 		Count: 2,
 	}
 	claims, promoItems, err = promo.Apply(prod)
@@ -114,7 +115,7 @@ func TestPromotion_ApplyDiscount(t *testing.T) {
 	expectedPromoItems := &store.Product{
 		SKU:   "DISCOUNT",
 		Name:  "A discount",
-		Price: -4.5,
+		Price: money.MustParse("-4.5"),
 		Count: 10,
 	}
 	claims, promoItems, err = promo.Apply(prod)
@@ -147,7 +148,7 @@ func TestPromotion_Apply(t *testing.T) {
 	prod := &store.Product{
 		SKU:   "12345678",
 		Name:  "Test",
-		Price: 11.5,
+		Price: money.MustParse("11.5"),
 		Count: 2,
 	}
 	claims, promoItems, err := promo.Apply(prod)
@@ -163,13 +164,13 @@ func TestPromotion_Apply(t *testing.T) {
 	prod = &store.Product{
 		SKU:   "ABC123",
 		Name:  "Test",
-		Price: 11.5,
+		Price: money.MustParse("11.5"),
 		Count: 2,
 	}
 	expectedPromoItems := &store.Product{
 		SKU:   "2FOR1",
 		Name:  "A 2 for 1",
-		Price: -11.5,
+		Price: money.MustParse("-11.5"),
 		Count: 1,
 	}
 	claims, promoItems, err = promo.Apply(prod)
@@ -182,4 +183,321 @@ func TestPromotion_Apply(t *testing.T) {
 	if err != nil {
 		t.Errorf("Got unexpected error for promotion: %+v", err)
 	}
+
+	prod.Count = 5
+	expectedPromoItems.Count = 2
+	if _, promoItems, _ = promo.Apply(prod); !reflect.DeepEqual(promoItems, expectedPromoItems) {
+		t.Errorf("Incorrect promotion items for several groups. Expected %+v, got %+v.", expectedPromoItems, promoItems)
+	}
+}
+
+func TestPromotion_ApplyCart(t *testing.T) {
+	contents := map[string]*store.Product{
+		"A1234": {
+			SKU:   "A1234",
+			Name:  "Carrot",
+			Price: money.MustParse("1.1"),
+			Count: 3,
+		},
+		"B1234": {
+			SKU:   "B1234",
+			Name:  "Stick",
+			Price: money.MustParse("0.15"),
+			Count: 2,
+		},
+	}
+	tests := []struct {
+		name     string
+		requires store.Requirement
+		rule     store.RuleDetail
+		expected *store.Product
+	}{
+		{
+			name:     "percentage over spend",
+			requires: store.Requirement{MinSpend: money.MustParse("3.6")},
+			rule:     store.RuleDetail{Discount: money.MustParseRate(".1")},
+			expected: &store.Product{SKU: "CARTPROMO", Name: "Cart promotion", Price: money.MustParse("-0.36"), Count: 1},
+		},
+		{
+			name:     "spend not reached",
+			requires: store.Requirement{MinSpend: money.MustParse("3.61")},
+			rule:     store.RuleDetail{Discount: money.MustParseRate(".1")},
+		},
+		{
+			name:     "fixed amount over item count",
+			requires: store.Requirement{Count: 5},
+			rule:     store.RuleDetail{Amount: money.MustParse("1")},
+			expected: &store.Product{SKU: "CARTPROMO", Name: "Cart promotion", Price: money.MustParse("-1"), Count: 1},
+		},
+		{
+			name:     "item count of one SKU not reached",
+			requires: store.Requirement{SKU: "B1234", Count: 3},
+			rule:     store.RuleDetail{Amount: money.MustParse("1")},
+		},
+		{
+			name:     "fixed amount capped at subtotal",
+			requires: store.Requirement{},
+			rule:     store.RuleDetail{Amount: money.MustParse("10")},
+			expected: &store.Product{SKU: "CARTPROMO", Name: "Cart promotion", Price: money.MustParse("-3.6"), Count: 1},
+		},
+	}
+	for _, test := range tests {
+		promo := &store.Promotion{
+			Name:     "Cart promotion",
+			SKU:      "CARTPROMO",
+			Category: "cart",
+			Requires: test.requires,
+			Rule:     test.rule,
+		}
+		promoItem, err := promo.ApplyCart(contents)
+		if err != nil {
+			t.Errorf("%s: got unexpected error: %+v", test.name, err)
+		}
+		if !reflect.DeepEqual(promoItem, test.expected) {
+			t.Errorf("%s: incorrect promotion item. Expected %+v, got %+v.", test.name, test.expected, promoItem)
+		}
+	}
+
+	promo := &store.Promotion{
+		SKU:      "EURO",
+		Category: "cart",
+		Rule:     store.RuleDetail{Amount: money.MustParse("1 EUR")},
+	}
+	if _, err := promo.ApplyCart(contents); err == nil {
+		t.Error("Applying a promotion in another currency did not throw an error.")
+	}
+}
+
+func TestRegisterPromotions_InvalidCart(t *testing.T) {
+	shop := store.NewMemoryShop()
+	invalid := []store.RuleDetail{
+		{},
+		{Discount: money.MustParseRate(".1"), Amount: money.MustParse("1")},
+		{Amount: money.MustParse("-1")},
+	}
+	for _, rule := range invalid {
+		promo := &store.Promotion{SKU: "CARTPROMO", Category: "cart", Rule: rule}
+		if err := shop.RegisterPromotions([]*store.Promotion{promo}); err == nil {
+			t.Errorf("Registering cart promotion with rule %+v did not throw an error.", rule)
+		}
+	}
+}
+
+func TestPromotion_ApplyBundle(t *testing.T) {
+	contents := map[string]*store.Product{
+		"A1234": {
+			SKU:   "A1234",
+			Name:  "Carrot",
+			Price: money.MustParse("1.1"),
+			Count: 5,
+		},
+		"B1234": {
+			SKU:   "B1234",
+			Name:  "Stick",
+			Price: money.MustParse("0.15"),
+			Count: 3,
+		},
+	}
+	promo := &store.Promotion{
+		Name:     "Carrot on a stick",
+		SKU:      "KIT",
+		Category: "bundle",
+		Bundle: []store.Requirement{
+			{
+				SKU:   "A1234",
+				Count: 2,
+			},
+			{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+		Rule: store.RuleDetail{
+			Price: money.MustParse("2"),
+		},
+	}
+	expected := &store.Product{
+		SKU:   "KIT",
+		Name:  "Carrot on a stick",
+		Price: money.MustParse("-0.35"),
+		Count: 2,
+	}
+	promoItem, err := promo.ApplyCart(contents)
+	if err != nil {
+		t.Errorf("Got unexpected error for promotion: %+v", err)
+	}
+	if !reflect.DeepEqual(promoItem, expected) {
+		t.Errorf("Incorrect promotion item. Expected %+v, got %+v.", expected, promoItem)
+	}
+
+	promo.Rule = store.RuleDetail{Discount: money.MustParseRate(".5")}
+	expected.Price = money.MustParse("-1.18")
+	if promoItem, _ = promo.ApplyCart(contents); !reflect.DeepEqual(promoItem, expected) {
+		t.Errorf("Incorrect promotion item. Expected %+v, got %+v.", expected, promoItem)
+	}
+
+	promo.Rule = store.RuleDetail{Price: money.MustParse("3")}
+	if promoItem, _ = promo.ApplyCart(contents); promoItem != nil {
+		t.Errorf("Got promotion item for a bundle priced above its products: %+v", promoItem)
+	}
+
+	delete(contents, "B1234")
+	promo.Rule = store.RuleDetail{Price: money.MustParse("2")}
+	if promoItem, _ = promo.ApplyCart(contents); promoItem != nil {
+		t.Errorf("Got promotion item for an incomplete bundle: %+v", promoItem)
+	}
+}
+
+func TestValidatePromotions_Bundle(t *testing.T) {
+	invalid := [][]store.Requirement{
+		nil,
+		{{SKU: "A1234", Count: 1}, {SKU: "A1234", Count: 1}},
+		{{SKU: "A1234", Count: 0}},
+		{{Count: 1}},
+	}
+	for _, bundle := range invalid {
+		promo := &store.Promotion{
+			SKU:      "KIT",
+			Category: "bundle",
+			Bundle:   bundle,
+			Rule:     store.RuleDetail{Price: money.MustParse("1")},
+		}
+		if err := store.ValidatePromotions([]*store.Promotion{promo}); err == nil {
+			t.Errorf("Validating bundle %+v did not throw an error.", bundle)
+		}
+	}
+	overDiscounted := &store.Promotion{
+		SKU:      "KIT",
+		Category: "bundle",
+		Bundle:   []store.Requirement{{SKU: "A1234", Count: 1}},
+		Rule:     store.RuleDetail{Discount: money.MustParseRate("5")},
+	}
+	if err := store.ValidatePromotions([]*store.Promotion{overDiscounted}); err == nil {
+		t.Error("Validating a bundle discount above 100% did not throw an error.")
+	}
+	if item, err := overDiscounted.ApplyCart(map[string]*store.Product{"A1234": {SKU: "A1234", Price: money.MustParse("1.2"), Count: 1}}); err != nil || item.Price != money.MustParse("-1.2") {
+		t.Errorf("Bundle discount not capped at the bundle price. Expected -1.20 USD, got %+v (%+v).", item, err)
+	}
+}
+
+func TestValidatePromotions_BuyGet(t *testing.T) {
+	invalid := []store.RuleDetail{
+		{SKU: "B1234", Count: 1},
+		{Count: 1, Discount: money.MustParseRate(".5")},
+		{SKU: "B1234", Count: 1, Discount: money.MustParseRate("1.5")},
+		{SKU: "B1234", Count: 1, Amount: money.MustParse("1"), MaxRewards: -1},
+	}
+	for _, rule := range invalid {
+		promo := &store.Promotion{
+			SKU:      "BXGY",
+			Category: "bxgy",
+			Requires: store.Requirement{SKU: "A1234", Count: 1},
+			Rule:     rule,
+		}
+		if err := store.ValidatePromotions([]*store.Promotion{promo}); err == nil {
+			t.Errorf("Validating rule %+v did not throw an error.", rule)
+		}
+	}
+}
+
+func TestPromotion_Validate(t *testing.T) {
+	invalid := []*store.Promotion{
+		{SKU: "UNKNOWN", Category: "bogof", Requires: store.Requirement{SKU: "A1234", Count: 1}},
+		{SKU: "NOCOUNT", Category: "freebie", Requires: store.Requirement{SKU: "A1234"}, Rule: store.RuleDetail{SKU: "B1234", Count: 1}},
+		{SKU: "NOREWARD", Category: "freebie", Requires: store.Requirement{SKU: "A1234", Count: 1}},
+		{SKU: "ALLFREE", Category: "n4m", Requires: store.Requirement{SKU: "A1234", Count: 3}},
+		{SKU: "NOTHINGOFF", Category: "discount", Requires: store.Requirement{SKU: "A1234", Count: 1}},
+		{Name: "No SKU", Category: "discount", Requires: store.Requirement{SKU: "A1234", Count: 1}, Rule: store.RuleDetail{Discount: money.MustParseRate(".1")}},
+	}
+	for _, promo := range invalid {
+		if err := promo.Validate(); err == nil {
+			t.Errorf("Validating promotion %+v did not throw an error.", promo)
+		}
+	}
+	valid := &store.Promotion{SKU: "3FOR2", Category: "n4m", Requires: store.Requirement{SKU: "A1234", Count: 3}, Rule: store.RuleDetail{Count: 2}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validating a valid promotion failed: %+v", err)
+	}
+}
+
+func TestShop_ManagePromotions(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	promo := &store.Promotion{
+		Name:     "10% off carrots",
+		SKU:      "10CARROT",
+		Category: "discount",
+		Requires: store.Requirement{SKU: "A1234", Count: 1},
+		Rule:     store.RuleDetail{Discount: money.MustParseRate(".1")},
+	}
+	if err := shop.CreatePromotion(promo); err != nil {
+		t.Fatalf("Creating promotion failed: %+v", err)
+	}
+	if err := shop.CreatePromotion(promo); err == nil {
+		t.Error("Creating a duplicate promotion did not throw an error.")
+	}
+	unstocked := &store.Promotion{
+		Name:     "10% off hats",
+		SKU:      "10HAT",
+		Category: "discount",
+		Requires: store.Requirement{SKU: "C1234", Count: 1},
+		Rule:     store.RuleDetail{Discount: money.MustParseRate(".1")},
+	}
+	if err := shop.CreatePromotion(unstocked); err == nil {
+		t.Error("Creating a promotion for a product which is not stocked did not throw an error.")
+	}
+	foreign := &store.Promotion{
+		Name:     "5 euros off",
+		SKU:      "EUR5",
+		Category: "cart",
+		Rule:     store.RuleDetail{Amount: money.MustParse("5 EUR")},
+	}
+	if err := shop.CreatePromotion(foreign); err == nil {
+		t.Error("Creating a promotion in another currency did not throw an error.")
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promos, _ := c.Get(); promos["10CARROT"] == nil {
+		t.Errorf("Created promotion not applied: %+v", promos)
+	}
+
+	invalid := *promo
+	invalid.Rule.Discount = 0
+	if err := shop.UpdatePromotion("10CARROT", &invalid); err == nil {
+		t.Error("Updating to an invalid promotion did not throw an error.")
+	}
+	updated := *promo
+	updated.Rule.Discount = money.MustParseRate(".5")
+	if err := shop.UpdatePromotion("10CARROT", &updated); err != nil {
+		t.Fatalf("Updating promotion failed: %+v", err)
+	}
+	if _, promos, _ := c.Get(); promos["10CARROT"] == nil || promos["10CARROT"].Price != money.MustParse("-0.55") {
+		t.Errorf("Updated promotion not applied: %+v", promos["10CARROT"])
+	}
+
+	if _, err := shop.EnablePromotion("10CARROT", false); err != nil {
+		t.Fatalf("Disabling promotion failed: %+v", err)
+	}
+	if _, promos, _ := c.Get(); len(promos) != 0 {
+		t.Errorf("Disabled promotion applied: %+v", promos)
+	}
+	if active := shop.ActivePromotions(); len(active) != 0 {
+		t.Errorf("Disabled promotion advertised: %+v", active)
+	}
+	if enabled, err := shop.EnablePromotion("10CARROT", true); err != nil || enabled.Disabled {
+		t.Errorf("Unexpected promotion after enabling: %+v (%+v)", enabled, err)
+	}
+
+	if _, err := shop.DeletePromotion("10CARROT"); err != nil {
+		t.Fatalf("Deleting promotion failed: %+v", err)
+	}
+	if _, err := shop.DeletePromotion("10CARROT"); err == nil {
+		t.Error("Deleting a missing promotion did not throw an error.")
+	}
+	if promos := shop.Promotions(); len(promos) != 0 {
+		t.Errorf("Deleted promotion still registered: %+v", promos)
+	}
 }
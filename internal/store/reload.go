@@ -0,0 +1,235 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ProductChange is a product whose entry differs between two versions of a stock list
+type ProductChange struct {
+	Before *Product
+	After  *Product
+}
+
+// StockDiff lists the differences between two versions of a stock list in order of SKU
+type StockDiff struct {
+	Added   []*Product
+	Removed []*Product
+	Changed []*ProductChange
+}
+
+// PromotionDiff lists the differences between two versions of a promotions list in order of SKU
+type PromotionDiff struct {
+	Added   []*Promotion
+	Removed []*Promotion
+	Changed []*Promotion
+}
+
+// DiffStock compares two versions of a stock list
+func DiffStock(before, after []*Product) *StockDiff {
+	diff := &StockDiff{
+		Added:   make([]*Product, 0),
+		Removed: make([]*Product, 0),
+		Changed: make([]*ProductChange, 0),
+	}
+	old := make(map[string]*Product, len(before))
+	for _, p := range before {
+		old[p.SKU] = p
+	}
+	current := make(map[string]*Product, len(after))
+	for _, p := range after {
+		current[p.SKU] = p
+		prev, ok := old[p.SKU]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, p)
+		case !reflect.DeepEqual(prev, p):
+			diff.Changed = append(diff.Changed, &ProductChange{Before: prev, After: p})
+		}
+	}
+	for _, p := range before {
+		if _, ok := current[p.SKU]; !ok {
+			diff.Removed = append(diff.Removed, p)
+		}
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].SKU < diff.Added[j].SKU })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].SKU < diff.Removed[j].SKU })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].After.SKU < diff.Changed[j].After.SKU })
+	return diff
+}
+
+// Empty checks if there are no differences
+func (d *StockDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String describes the differences with one product per line
+func (d *StockDiff) String() string {
+	lines := make([]string, 0)
+	for _, p := range d.Added {
+		lines = append(lines, fmt.Sprintf(`+ %s "%s" at %s, stock %d`, p.SKU, p.Name, p.Price, p.Count))
+	}
+	for _, p := range d.Removed {
+		lines = append(lines, fmt.Sprintf(`- %s "%s"`, p.SKU, p.Name))
+	}
+	for _, c := range d.Changed {
+		changes := make([]string, 0)
+		if c.Before.Name != c.After.Name {
+			changes = append(changes, fmt.Sprintf(`name "%s" -> "%s"`, c.Before.Name, c.After.Name))
+		}
+		if c.Before.Price != c.After.Price {
+			changes = append(changes, fmt.Sprintf("price %s -> %s", c.Before.Price, c.After.Price))
+		}
+		if c.Before.Count != c.After.Count {
+			changes = append(changes, fmt.Sprintf("stock %d -> %d", c.Before.Count, c.After.Count))
+		}
+		if !reflect.DeepEqual(c.Before.Tiers, c.After.Tiers) {
+			changes = append(changes, "price tiers changed")
+		}
+		if catalogueChanged(c.Before, c.After) {
+			changes = append(changes, "catalogue details changed")
+		}
+		lines = append(lines, fmt.Sprintf("~ %s: %s", c.After.SKU, strings.Join(changes, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// catalogueChanged checks if the details shown on a product page differ between two versions of a product
+func catalogueChanged(before, after *Product) bool {
+	return before.Brand != after.Brand ||
+		before.Description != after.Description ||
+		!reflect.DeepEqual(before.Categories, after.Categories) ||
+		!reflect.DeepEqual(before.Images, after.Images) ||
+		!reflect.DeepEqual(before.Attributes, after.Attributes)
+}
+
+// DiffPromotions compares two versions of a promotions list
+func DiffPromotions(before, after []*Promotion) *PromotionDiff {
+	diff := &PromotionDiff{
+		Added:   make([]*Promotion, 0),
+		Removed: make([]*Promotion, 0),
+		Changed: make([]*Promotion, 0),
+	}
+	old := make(map[string]*Promotion, len(before))
+	for _, p := range before {
+		old[p.SKU] = p
+	}
+	current := make(map[string]*Promotion, len(after))
+	for _, p := range after {
+		current[p.SKU] = p
+		prev, ok := old[p.SKU]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, p)
+		case !reflect.DeepEqual(prev, p):
+			diff.Changed = append(diff.Changed, p)
+		}
+	}
+	for _, p := range before {
+		if _, ok := current[p.SKU]; !ok {
+			diff.Removed = append(diff.Removed, p)
+		}
+	}
+	for _, promos := range [][]*Promotion{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(promos, func(i, j int) bool { return promos[i].SKU < promos[j].SKU })
+	}
+	return diff
+}
+
+// Empty checks if there are no differences
+func (d *PromotionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String describes the differences with one promotion per line
+func (d *PromotionDiff) String() string {
+	lines := make([]string, 0)
+	for _, p := range d.Added {
+		lines = append(lines, fmt.Sprintf(`+ %s "%s"`, p.SKU, p.Name))
+	}
+	for _, p := range d.Removed {
+		lines = append(lines, fmt.Sprintf(`- %s "%s"`, p.SKU, p.Name))
+	}
+	for _, p := range d.Changed {
+		lines = append(lines, fmt.Sprintf(`~ %s "%s"`, p.SKU, p.Name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MergeStock applies the differences between two versions of a stock list to the live inventory in one step.
+// Stock levels move by the difference in stock between the versions, so stock claimed by carts stays claimed. Only
+// the fields which differ between the versions are changed, so changes made through the admin API are kept.
+// Products removed from the list are discontinued rather than deleted so carts still holding them can give them back.
+func (s *Shop) MergeStock(diff *StockDiff) error {
+	for _, p := range diff.Added {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, c := range diff.Changed {
+		if err := c.After.Validate(); err != nil {
+			return err
+		}
+	}
+	return s.inventory.Update(func(products map[string]*Product) error {
+		for _, p := range diff.Removed {
+			if existing, ok := products[p.SKU]; ok {
+				removed := *existing
+				removed.Discontinued = true
+				removed.Count = moveStock(existing, existing.Count-p.Count)
+				products[p.SKU] = &removed
+			}
+		}
+		for _, p := range diff.Added {
+			added := *p
+			if existing, ok := products[p.SKU]; ok { // already stocked, e.g. from a stored inventory
+				added.Count += existing.Count
+			}
+			products[p.SKU] = &added
+		}
+		for _, c := range diff.Changed {
+			changed := *c.After
+			if existing, ok := products[c.After.SKU]; ok {
+				changed = mergeProduct(existing, c)
+				changed.Count = moveStock(&changed, existing.Count+c.After.Count-c.Before.Count)
+			}
+			products[c.After.SKU] = &changed
+		}
+		if err := checkVariants(products); err != nil {
+			return err
+		}
+		currency := ""
+		for _, sku := range sortedSKUs(products) {
+			p := products[sku]
+			if currency == "" {
+				currency = p.Price.Currency
+			} else if p.Price.Currency != currency {
+				return fmt.Errorf(`SKU "%s" is priced in %s but the shop uses %s`, p.SKU, p.Price.Currency, currency)
+			}
+		}
+		return nil
+	})
+}
+
+// mergeProduct applies the fields which differ between two versions of a stock list entry to a live product
+func mergeProduct(live *Product, c *ProductChange) Product {
+	merged := *live
+	mergedFields := reflect.ValueOf(&merged).Elem()
+	before, after := reflect.ValueOf(c.Before).Elem(), reflect.ValueOf(c.After).Elem()
+	for i := 0; i < mergedFields.NumField(); i++ {
+		if !reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			mergedFields.Field(i).Set(after.Field(i))
+		}
+	}
+	return merged
+}
+
+// moveStock floors a stock level moved by a reload at zero unless the product can be backordered
+func moveStock(p *Product, count int) int {
+	if count < 0 && !p.Backorder { // more was claimed or sold than is left
+		return 0
+	}
+	return count
+}
@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"path/filepath"
+	"testing"
+)
+
+func reloadStock() ([]*store.Product, []*store.Product) {
+	before := []*store.Product{
+		{SKU: "A1234", Name: "Carrot", Price: money.MustParse("1.1"), Count: 10},
+		{SKU: "B1234", Name: "Stick", Price: money.MustParse("0.1"), Count: 5},
+	}
+	after := []*store.Product{
+		{SKU: "A1234", Name: "Carrot", Price: money.MustParse("1.2"), Count: 12},
+		{SKU: "C1234", Name: "Hat", Price: money.MustParse("5"), Count: 2},
+	}
+	return before, after
+}
+
+func TestDiffStock(t *testing.T) {
+	diff := store.DiffStock(reloadStock())
+	expected := "+ C1234 \"Hat\" at 5.00 USD, stock 2\n- B1234 \"Stick\"\n~ A1234: price 1.10 USD -> 1.20 USD, stock 10 -> 12"
+	if diff.String() != expected {
+		t.Errorf("Unexpected diff. Expected %q, got %q.", expected, diff.String())
+	}
+	if before, _ := reloadStock(); !store.DiffStock(before, before).Empty() {
+		t.Error("Identical stock lists are reported as different.")
+	}
+}
+
+func TestMergeStock(t *testing.T) {
+	for _, backend := range []string{"memory", "bolt"} {
+		shop := store.NewMemoryShop()
+		if backend == "bolt" {
+			var db *store.BoltDB
+			shop, db = openBoltShop(t, filepath.Join(t.TempDir(), "shop.db"))
+			defer db.Close()
+		}
+		before, after := reloadStock()
+		if err := shop.StockShop(before); err != nil {
+			t.Fatalf("Test setup failed: %+v", err)
+		}
+		_, cart := shop.RetrieveCart(nil)
+		if err := cart.Add(&store.Product{SKU: "A1234", Count: 3}); err != nil {
+			t.Fatalf("Adding to cart failed: %+v", err)
+		}
+		if err := cart.Add(&store.Product{SKU: "B1234", Count: 2}); err != nil {
+			t.Fatalf("Adding to cart failed: %+v", err)
+		}
+		name := "Orange carrot"
+		if _, err := shop.UpdateProduct("A1234", store.ProductUpdate{Name: &name}); err != nil {
+			t.Fatalf("Updating product failed: %+v", err)
+		}
+		if err := shop.MergeStock(store.DiffStock(before, after)); err != nil {
+			t.Fatalf("Merging stock into %s inventory failed: %+v", backend, err)
+		}
+		inventory := shop.GetInventory()
+		if carrot := inventory["A1234"]; carrot == nil || carrot.Count != 9 || carrot.Price != money.MustParse("1.2") {
+			t.Errorf("Claims not preserved in %s inventory. Expected 9 carrots at 1.20 USD, got %+v.", backend, carrot)
+		}
+		if carrot := inventory["A1234"]; carrot == nil || carrot.Name != "Orange carrot" {
+			t.Errorf("Merge undid admin change in %s inventory: %+v", backend, carrot)
+		}
+		if stick := inventory["B1234"]; stick == nil || !stick.Discontinued {
+			t.Errorf("Removed product not discontinued in %s inventory: %+v", backend, stick)
+		}
+		if err := cart.Remove(&store.Product{SKU: "B1234", Count: 2}); err != nil {
+			t.Errorf("Removing a removed product from a cart failed: %+v", err)
+		}
+		if stick := shop.GetInventory()["B1234"]; stick == nil || stick.Count != 2 {
+			t.Errorf("Stock of removed product not released in %s inventory: %+v", backend, stick)
+		}
+		if hat := inventory["C1234"]; hat == nil || hat.Count != 2 {
+			t.Errorf("Added product not in %s inventory: %+v", backend, hat)
+		}
+		if items, _, _ := cart.Get(); items["A1234"].Count != 3 {
+			t.Errorf("Cart lost its claim. Expected 3 carrots, got %d.", items["A1234"].Count)
+		}
+
+		after[1].Price = money.MustParse("5 EUR")
+		if err := shop.MergeStock(store.DiffStock(before, after)); err == nil {
+			t.Errorf("Merging mixed currencies into %s inventory did not throw an error.", backend)
+		}
+		if inventory := shop.GetInventory(); inventory["C1234"].Price.Currency != "USD" {
+			t.Errorf("Failed merge changed the %s inventory.", backend)
+		}
+	}
+}
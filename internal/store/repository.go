@@ -0,0 +1,110 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// errDiscontinued is returned by an InventoryRepository when stock of a discontinued product is claimed
+var errDiscontinued = errors.New("discontinued")
+
+// isDiscontinued checks if a claim failed because the product has been discontinued
+func isDiscontinued(err error) bool {
+	return errors.Is(err, errDiscontinued)
+}
+
+// InventoryRepository holds the shop's stock. Claims and releases must be atomic.
+type InventoryRepository interface {
+	// Replace replaces the whole inventory
+	Replace(stock []*Product) error
+	// Claim claims stock for a cart, claiming whatever is left if there is not enough
+	Claim(product Product) (*Product, error)
+	// Release returns claimed stock
+	Release(product Product) error
+	// All returns a snapshot of the inventory
+	All() (map[string]*Product, error)
+	// Update changes several products in one step. The change works on a copy of the inventory which replaces
+	// it unless the change fails.
+	Update(change func(products map[string]*Product) error) error
+}
+
+// PromotionRepository holds the promotions on offer
+type PromotionRepository interface {
+	// Replace replaces all promotions
+	Replace(promos []*Promotion) error
+	// All returns all promotions in the order they were registered
+	All() ([]*Promotion, error)
+	// ClaimCode records a use of a coupon code unless it has already been used limit times. A limit of 0 means
+	// unlimited. Uses are kept when the promotions are replaced.
+	ClaimCode(code string, limit int) error
+	// ReleaseCode gives back a use of a coupon code
+	ReleaseCode(code string) error
+}
+
+// CartRepository persists the state of carts
+type CartRepository interface {
+	// Put stores the state of a cart
+	Put(cartId uuid.UUID, cart *CartRecord) error
+	// Delete removes a cart
+	Delete(cartId uuid.UUID) error
+	// All returns all stored carts
+	All() (map[uuid.UUID]*CartRecord, error)
+}
+
+// OrderRepository persists placed orders
+type OrderRepository interface {
+	// Put stores an order
+	Put(order *Order) error
+	// All returns all stored orders
+	All() ([]*Order, error)
+}
+
+// CartRecord is the state of a cart as held by a CartRepository
+type CartRecord struct {
+	Contents   map[string]*Product
+	PromoCache map[string]*Product
+	Coupons    []string
+	Expires    time.Time
+	// Lines orders the contents. NextLine is the number of the last line added.
+	Lines    []LineRef
+	NextLine int
+}
+
+// claimCode records a use of a coupon code in a usage count
+func claimCode(uses int, limit int) (int, error) {
+	if limit > 0 && uses >= limit {
+		return uses, errCodeExhausted
+	}
+	return uses + 1, nil
+}
+
+// releaseCode gives back a use of a coupon code in a usage count
+func releaseCode(code string, uses int) (int, error) {
+	if uses <= 0 {
+		return 0, fmt.Errorf(`coupon code "%s" has not been used`, code)
+	}
+	return uses - 1, nil
+}
+
+// claimStock takes stock from a product in the inventory, taking whatever is left if there is not enough and the
+// product cannot be backordered. Claiming nothing of a discontinued product succeeds, so carts still holding it can
+// be updated.
+func claimStock(invProd *Product, product Product) (*Product, error) {
+	if invProd.Discontinued && product.Count > 0 {
+		return nil, fmt.Errorf(`SKU "%s" has been %w`, invProd.SKU, errDiscontinued)
+	}
+	successfulClaim := product
+	successfulClaim.Name = invProd.Name
+	successfulClaim.Price = invProd.Price
+	successfulClaim.Tiers = invProd.Tiers
+	successfulClaim.Parent = invProd.Parent
+	invProd.Count -= product.Count
+	if invProd.Count < 0 && !invProd.Backorder {
+		successfulClaim.Count += invProd.Count
+		invProd.Count = 0
+		return &successfulClaim, fmt.Errorf(`not enough stock`)
+	}
+	return &successfulClaim, nil
+}
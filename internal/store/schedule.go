@@ -0,0 +1,177 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minutesPerDay is the end of the last window of a day
+const minutesPerDay = 24 * 60
+
+// Schedule restricts a promotion to a recurring window such as every Friday from 18:00
+type Schedule struct {
+	// Days lists the days the promotion runs on. No days means every day.
+	Days []Weekday `yaml:"days,omitempty"`
+	// From is the time of day the promotion starts
+	From TimeOfDay `yaml:"from,omitempty"`
+	// Until is the time of day the promotion ends. Zero means the end of the day.
+	Until TimeOfDay `yaml:"until,omitempty"`
+	// Timezone is the IANA name of the time zone the schedule is in. Empty means UTC.
+	Timezone string `yaml:"timezone,omitempty"`
+}
+
+// Weekday is a day of the week which can be read from YAML by name, e.g. "friday" or "Fri"
+type Weekday time.Weekday
+
+// TimeOfDay is a number of minutes since midnight which can be read from YAML as "HH:MM"
+type TimeOfDay int
+
+// locations caches time zones so they are not loaded for every cart
+var locations sync.Map
+
+// loadLocation loads a time zone by its IANA name
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// ParseWeekday parses the full or three-letter English name of a day of the week
+func ParseWeekday(in string) (Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(in))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || name == full[:3] {
+			return Weekday(d), nil
+		}
+	}
+	return 0, fmt.Errorf(`invalid day "%s"`, in)
+}
+
+// UnmarshalYAML reads a day of the week from YAML
+func (d *Weekday) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var in string
+	if err := unmarshal(&in); err != nil {
+		return err
+	}
+	parsed, err := ParseWeekday(in)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// MarshalYAML writes a day of the week to YAML by name
+func (d Weekday) MarshalYAML() (interface{}, error) {
+	return strings.ToLower(time.Weekday(d).String()), nil
+}
+
+// ParseTimeOfDay parses a time of day such as "18:30". "24:00" is the end of the day.
+func ParseTimeOfDay(in string) (TimeOfDay, error) {
+	parts := strings.SplitN(strings.TrimSpace(in), ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf(`invalid time of day "%s"`, in)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf(`invalid time of day "%s"`, in)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes >= 60 {
+		return 0, fmt.Errorf(`invalid time of day "%s"`, in)
+	}
+	t := TimeOfDay(hours*60 + minutes)
+	if hours < 0 || t > minutesPerDay {
+		return 0, fmt.Errorf(`invalid time of day "%s"`, in)
+	}
+	return t, nil
+}
+
+// UnmarshalYAML reads a time of day from YAML
+func (t *TimeOfDay) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var in string
+	if err := unmarshal(&in); err != nil {
+		return err
+	}
+	parsed, err := ParseTimeOfDay(in)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// MarshalYAML writes a time of day to YAML as "HH:MM"
+func (t TimeOfDay) MarshalYAML() (interface{}, error) {
+	return fmt.Sprintf("%02d:%02d", t/60, t%60), nil
+}
+
+// validate checks that the schedule describes a window which can be open
+func (s *Schedule) validate() error {
+	if _, err := loadLocation(s.Timezone); err != nil {
+		return fmt.Errorf(`invalid timezone "%s": %w`, s.Timezone, err)
+	}
+	for _, d := range s.Days {
+		if d < Weekday(time.Sunday) || d > Weekday(time.Saturday) {
+			return fmt.Errorf(`invalid day %d`, d)
+		}
+	}
+	if s.From < 0 || s.From >= minutesPerDay || s.Until < 0 || s.Until > minutesPerDay {
+		return fmt.Errorf(`invalid window from %d until %d`, s.From, s.Until)
+	}
+	if s.Until != 0 && s.Until <= s.From {
+		return fmt.Errorf(`window must end after it starts`)
+	}
+	return nil
+}
+
+// openAt checks if the schedule's window is open at the given time
+func (s *Schedule) openAt(now time.Time) bool {
+	loc, err := loadLocation(s.Timezone)
+	if err != nil {
+		return false
+	}
+	local := now.In(loc)
+	if len(s.Days) > 0 {
+		onDay := false
+		for _, d := range s.Days {
+			if time.Weekday(d) == local.Weekday() {
+				onDay = true
+				break
+			}
+		}
+		if !onDay {
+			return false
+		}
+	}
+	minute := TimeOfDay(local.Hour()*60 + local.Minute())
+	until := s.Until
+	if until == 0 {
+		until = minutesPerDay
+	}
+	return minute >= s.From && minute < until
+}
+
+// activeAt checks if a promotion runs at the given time
+func (p *Promotion) activeAt(now time.Time) bool {
+	if p.Disabled {
+		return false
+	}
+	if !p.ValidFrom.IsZero() && now.Before(p.ValidFrom) {
+		return false
+	}
+	if !p.ValidUntil.IsZero() && !now.Before(p.ValidUntil) {
+		return false
+	}
+	return p.Schedule == nil || p.Schedule.openAt(now)
+}
@@ -0,0 +1,118 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/store"
+	"testing"
+	"time"
+)
+
+func TestParseWeekday(t *testing.T) {
+	for in, expected := range map[string]time.Weekday{"friday": time.Friday, "Sun": time.Sunday, " MONDAY ": time.Monday} {
+		d, err := store.ParseWeekday(in)
+		if err != nil || time.Weekday(d) != expected {
+			t.Errorf("Unexpected day for %q. Expected %s, got %d (%+v).", in, expected, d, err)
+		}
+	}
+	if _, err := store.ParseWeekday("Caturday"); err == nil {
+		t.Error("Parsing an invalid day did not throw an error.")
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	for in, expected := range map[string]store.TimeOfDay{"00:00": 0, "18:30": 18*60 + 30, "24:00": 24 * 60} {
+		tod, err := store.ParseTimeOfDay(in)
+		if err != nil || tod != expected {
+			t.Errorf("Unexpected time of day for %q. Expected %d, got %d (%+v).", in, expected, tod, err)
+		}
+	}
+	for _, in := range []string{"18", "25:00", "12:60", "-1:00", "ab:cd"} {
+		if _, err := store.ParseTimeOfDay(in); err == nil {
+			t.Errorf("Parsing invalid time of day %q did not throw an error.", in)
+		}
+	}
+}
+
+func TestCart_GetTimeWindow(t *testing.T) {
+	// a Friday at noon
+	clock := &fakeClock{now: time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC)}
+	shop, err := store.NewShop(store.NewMemoryInventory(), store.NewMemoryPromotions(), store.NewMemoryCarts(), store.NewMemoryOrders(), clock)
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	if err := stockShop(shop); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err = shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:       "Friday afternoon freebie",
+			SKU:        "FRIDAY",
+			Category:   "freebie",
+			ValidFrom:  clock.Now().Add(time.Hour),
+			ValidUntil: clock.Now().Add(14 * 24 * time.Hour),
+			Schedule: &store.Schedule{
+				Days:  []store.Weekday{store.Weekday(time.Friday)},
+				From:  12 * 60,
+				Until: 18 * 60,
+			},
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	_, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+
+	steps := []struct {
+		advance time.Duration
+		applied bool
+	}{
+		{0, false},                            // before validFrom
+		{time.Hour, true},                     // Friday 13:00
+		{5 * time.Hour, false},                // Friday 18:00, window closed
+		{6*24*time.Hour + 20*time.Hour, true}, // next Friday 14:00
+		{7 * 24 * time.Hour, false},           // Friday 14:00 after validUntil
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		_, promo, errors := cart.Get()
+		if errors != nil {
+			t.Fatalf("Retrieving cart failed: %+v", errors)
+		}
+		_, applied := promo["FRIDAY"]
+		if applied != step.applied {
+			t.Errorf("Step %d at %s: expected promotion applied to be %t.", i, clock.Now(), step.applied)
+		}
+		expectedStock := 5
+		if step.applied {
+			expectedStock = 3
+		}
+		if count := shop.GetInventory()["B1234"].Count; count != expectedStock {
+			t.Errorf("Step %d: unexpected freebie stock. Expected %d, got %d.", i, expectedStock, count)
+		}
+	}
+}
+
+func TestRegisterPromotions_InvalidWindow(t *testing.T) {
+	shop := store.NewMemoryShop()
+	now := time.Now()
+	invalid := []*store.Promotion{
+		{SKU: "BACKWARDS", ValidFrom: now, ValidUntil: now.Add(-time.Hour)},
+		{SKU: "NOWHERE", Schedule: &store.Schedule{Timezone: "Atlantis/Capital"}},
+		{SKU: "SHORT", Schedule: &store.Schedule{From: 18 * 60, Until: 12 * 60}},
+	}
+	for _, p := range invalid {
+		if err := shop.RegisterPromotions([]*store.Promotion{p}); err == nil {
+			t.Errorf("Registering promotion %s did not throw an error.", p.SKU)
+		}
+	}
+}
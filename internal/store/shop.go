@@ -0,0 +1,97 @@
+package store
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"time"
+)
+
+// Clock tells a shop the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the wall clock
+var SystemClock Clock = systemClock{}
+
+// Shop holds the inventory, promotions, carts and orders of one shop. Shops are independent of each other.
+type Shop struct {
+	// cartTTL and expiryWarning are accessed atomically and hold nanoseconds. They come first to keep them aligned.
+	cartTTL       int64
+	expiryWarning int64
+	// promotionStrategy is accessed atomically
+	promotionStrategy int32
+
+	inventory       InventoryRepository
+	promotions      PromotionRepository
+	cartRepository  CartRepository
+	orderRepository OrderRepository
+	clock           Clock
+
+	// promotionsLock serialises changes to the list of promotions
+	promotionsLock sync.Mutex
+
+	carts map[uuid.UUID]*Cart
+	// cartsLock guards carts. It must never be acquired while holding a cart's lock.
+	cartsLock sync.RWMutex
+
+	orders     map[uuid.UUID]*Order
+	ordersLock sync.RWMutex
+
+	subscribers map[uuid.UUID]map[chan CartEvent]struct{}
+	// subscribersLock guards subscribers. Events are published while holding cart locks, so it must be acquired last.
+	subscribersLock sync.Mutex
+}
+
+// NewShop creates a shop with the given repositories and restores the carts and orders held by them
+func NewShop(inventoryRepo InventoryRepository, promotionRepo PromotionRepository, cartRepo CartRepository, orderRepo OrderRepository, clock Clock) (*Shop, error) {
+	records, err := cartRepo.All()
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore carts: %w", err)
+	}
+	orders, err := orderRepo.All()
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore orders: %w", err)
+	}
+	s := &Shop{
+		cartTTL:         int64(defaultCartTTL),
+		expiryWarning:   int64(defaultExpiryWarning),
+		inventory:       inventoryRepo,
+		promotions:      promotionRepo,
+		cartRepository:  cartRepo,
+		orderRepository: orderRepo,
+		clock:           clock,
+		carts:           make(map[uuid.UUID]*Cart, len(records)),
+		orders:          make(map[uuid.UUID]*Order, len(orders)),
+		subscribers:     make(map[uuid.UUID]map[chan CartEvent]struct{}),
+	}
+	for _, order := range orders {
+		s.orders[order.ID] = order
+	}
+	for cartId, record := range records {
+		s.carts[cartId] = &Cart{
+			shop:       s,
+			id:         cartId,
+			contents:   record.Contents,
+			lines:      record.Lines,
+			nextLine:   record.NextLine,
+			promoCache: record.PromoCache,
+			coupons:    record.Coupons,
+			expires:    record.Expires,
+		}
+	}
+	return s, nil
+}
+
+// NewMemoryShop creates an empty shop which is held in memory and runs on the wall clock
+func NewMemoryShop() *Shop {
+	s, _ := NewShop(NewMemoryInventory(), NewMemoryPromotions(), NewMemoryCarts(), NewMemoryOrders(), SystemClock)
+	return s
+}
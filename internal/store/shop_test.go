@@ -0,0 +1,54 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/store"
+	"testing"
+)
+
+func TestNewShop_Independent(t *testing.T) {
+	t.Parallel()
+	shop, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	other, err := newTestShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	cartId, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "A1234", Count: 4}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if other.CartExists(*cartId) {
+		t.Error("Cart created in one shop exists in another.")
+	}
+	if count := shop.GetInventory()["A1234"].Count; count != 6 {
+		t.Errorf("Stock not claimed. Expected 6, got %d.", count)
+	}
+	if count := other.GetInventory()["A1234"].Count; count != 10 {
+		t.Errorf("Claim changed another shop's stock. Expected 10, got %d.", count)
+	}
+	if err := other.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "A freebie",
+			SKU:      "FREEBIE",
+			Category: "freebie",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "B1234",
+				Count: 1,
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	if _, promo, errors := cart.Get(); errors != nil || len(promo) != 0 {
+		t.Errorf("Promotions of another shop applied. Got %+v, %+v.", promo, errors)
+	}
+	if _, err := other.Checkout(*cartId); err == nil {
+		t.Error("Checking out a cart of another shop did not throw an error.")
+	}
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/money"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// PromotionStrategy decides which promotions apply to a cart when promotions conflict
+type PromotionStrategy int32
+
+const (
+	// BestForCustomer applies the combination of promotions which saves the customer the most
+	BestForCustomer PromotionStrategy = iota
+	// FirstByPriority applies promotions by priority, skipping those which conflict with promotions already applied
+	FirstByPriority
+)
+
+var strategyNames = map[PromotionStrategy]string{
+	BestForCustomer: "best",
+	FirstByPriority: "priority",
+}
+
+// SkippedPromotion is a promotion a cart qualified for which was not applied because of another promotion
+type SkippedPromotion struct {
+	SKU    string
+	Name   string
+	Reason string
+}
+
+// candidate is a promotion which applies to a cart before conflicts with other promotions are resolved
+type candidate struct {
+	promo *Promotion
+	// index is the position the promotion was registered at
+	index int
+	// claim is the stock a freebie needs
+	claim *Product
+	item  *Product
+	// skus lists the products in the cart the promotion applies to in order
+	skus   []string
+	saving money.Money
+}
+
+// skippedCandidate is a candidate which was not applied because it conflicts with an applied promotion
+type skippedCandidate struct {
+	promo  *Promotion
+	reason string
+}
+
+// ParsePromotionStrategy parses the name of a promotion strategy, "best" or "priority"
+func ParsePromotionStrategy(in string) (PromotionStrategy, error) {
+	for strategy, name := range strategyNames {
+		if strings.EqualFold(strings.TrimSpace(in), name) {
+			return strategy, nil
+		}
+	}
+	return 0, fmt.Errorf(`unknown promotion strategy "%s"`, in)
+}
+
+func (s PromotionStrategy) String() string {
+	return strategyNames[s]
+}
+
+// SetPromotionStrategy sets how the shop resolves conflicting promotions
+func (s *Shop) SetPromotionStrategy(strategy PromotionStrategy) {
+	atomic.StoreInt32(&s.promotionStrategy, int32(strategy))
+}
+
+// PromotionStrategy returns how the shop resolves conflicting promotions
+func (s *Shop) PromotionStrategy() PromotionStrategy {
+	return PromotionStrategy(atomic.LoadInt32(&s.promotionStrategy))
+}
+
+// tierPromotions turns the price tiers of the products in the cart into promotions. The caller must hold the
+// cart's lock.
+func (c *Cart) tierPromotions() []*Promotion {
+	promos := make([]*Promotion, 0)
+	for _, sku := range sortedSKUs(c.contents) {
+		if product := c.contents[sku]; len(product.Tiers) > 0 {
+			promos = append(promos, tierPromotion(product))
+		}
+	}
+	return promos
+}
+
+// promotionCandidates applies each promotion to the cart on its own. The caller must hold the cart's lock.
+func (c *Cart) promotionCandidates(promos []*Promotion) ([]*candidate, []error) {
+	errors := make([]error, 0)
+	candidates := make([]*candidate, 0)
+	var inventory map[string]*Product // only looked up to value claimed items
+	for i, promo := range promos {
+		var claim, item *Product
+		var err error
+		contents := promo.promotionContents(c.contents)
+		switch promo.Category {
+		case "cart", "bundle":
+			item, err = promo.ApplyCart(contents)
+		default:
+			product, ok := contents[promo.Requires.SKU]
+			perVariant := promo.Category == "discount" || promo.Category == "tiered"
+			if ok && perVariant && promo.targetedParents(c.contents)[product.SKU] {
+				item, err = promo.applyVariants(product, c.contents)
+			} else if ok {
+				claim, item, err = promo.Apply(product)
+			}
+		}
+		if err != nil {
+			errors = append(errors, fmt.Errorf(`internal error: %w`, err))
+		}
+		if item == nil || item.Count <= 0 {
+			continue
+		}
+		var price money.Money // the list price of claimed items
+		if claim != nil {
+			if product, ok := c.contents[claim.SKU]; ok {
+				price = product.Price
+			} else {
+				if inventory == nil {
+					inventory = c.shop.GetInventory()
+				}
+				if product, ok := inventory[claim.SKU]; ok {
+					price = product.Price
+				}
+			}
+			if promo.Category == "bxgy" {
+				if item.Price, err = promo.rewardPrice(price); err != nil {
+					errors = append(errors, fmt.Errorf(`internal error: %w`, err))
+					continue
+				}
+			}
+		}
+		saving := item.Price.Mul(int64(item.Count)).Neg().Add(price.Mul(int64(item.Count)))
+		candidates = append(candidates, &candidate{
+			promo:  promo,
+			index:  i,
+			claim:  claim,
+			item:   item,
+			skus:   expandParents(promo.appliesTo(contents), c.contents),
+			saving: saving,
+		})
+	}
+	return candidates, errors
+}
+
+// appliesTo lists the products in a cart a promotion applies to
+func (p *Promotion) appliesTo(contents map[string]*Product) []string {
+	skus := make([]string, 0)
+	switch p.Category {
+	case "cart":
+		for sku := range contents {
+			skus = append(skus, sku)
+		}
+	case "bundle":
+		for _, item := range p.Bundle {
+			skus = append(skus, item.SKU)
+		}
+	default:
+		skus = append(skus, p.Requires.SKU)
+	}
+	sort.Strings(skus)
+	return skus
+}
+
+// conflict explains why a candidate cannot apply together with another. It is empty if they can.
+func (c *candidate) conflict(other *candidate) string {
+	if c.promo.Group != "" && c.promo.Group == other.promo.Group {
+		return fmt.Sprintf(`only one promotion of group "%s" applies and "%s" was chosen`, c.promo.Group, other.promo.SKU)
+	}
+	if c.promo.Stackable && other.promo.Stackable {
+		return ""
+	}
+	for _, sku := range c.skus {
+		for _, otherSku := range other.skus {
+			if sku == otherSku {
+				return fmt.Sprintf(`does not stack with "%s" on SKU "%s"`, other.promo.SKU, sku)
+			}
+		}
+	}
+	return ""
+}
+
+// compatible checks if a candidate can apply together with all chosen candidates
+func compatible(candidates []*candidate, chosen []bool, i int) bool {
+	for j, isChosen := range chosen {
+		if isChosen && j != i && candidates[i].conflict(candidates[j]) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// resolvePromotions picks the promotions to apply from candidates which may conflict. The result only depends
+// on the candidates and the strategy, not on the order of the cart's contents.
+func resolvePromotions(strategy PromotionStrategy, candidates []*candidate) ([]*candidate, []*skippedCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].promo.Priority != candidates[j].promo.Priority {
+			return candidates[i].promo.Priority > candidates[j].promo.Priority
+		}
+		return candidates[i].index < candidates[j].index
+	})
+	var chosen []bool
+	if strategy == FirstByPriority {
+		chosen = make([]bool, len(candidates))
+	} else {
+		chosen = bestCombination(candidates)
+	}
+	// FirstByPriority takes every candidate which still fits in order. The best combination may leave out
+	// candidates which save nothing.
+	for i := range candidates {
+		if !chosen[i] && compatible(candidates, chosen, i) {
+			chosen[i] = true
+		}
+	}
+	applied := make([]*candidate, 0, len(candidates))
+	for i, c := range candidates {
+		if chosen[i] {
+			applied = append(applied, c)
+		}
+	}
+	skipped := make([]*skippedCandidate, 0)
+	for i, c := range candidates {
+		if chosen[i] {
+			continue
+		}
+		for _, other := range applied {
+			if reason := c.conflict(other); reason != "" {
+				skipped = append(skipped, &skippedCandidate{
+					promo:  c.promo,
+					reason: reason,
+				})
+				break
+			}
+		}
+	}
+	return applied, skipped
+}
+
+// skippedPromotions describes the candidates which lost out to other promotions
+func skippedPromotions(skipped []*skippedCandidate) []*SkippedPromotion {
+	promos := make([]*SkippedPromotion, 0, len(skipped))
+	for _, s := range skipped {
+		promos = append(promos, &SkippedPromotion{
+			SKU:    s.promo.SKU,
+			Name:   s.promo.Name,
+			Reason: s.reason,
+		})
+	}
+	return promos
+}
+
+// bestCombination searches for the compatible candidates saving the most. Of equally good combinations, the one
+// preferring candidates earlier in the list wins.
+func bestCombination(candidates []*candidate) []bool {
+	remaining := make([]money.Money, len(candidates)+1)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1]
+		if candidates[i].saving.Amount > 0 {
+			remaining[i] = remaining[i].Add(candidates[i].saving)
+		}
+	}
+	best := make([]bool, len(candidates))
+	bestSaving := money.Money{}
+	current := make([]bool, len(candidates))
+	var search func(i int, saving money.Money)
+	search = func(i int, saving money.Money) {
+		if i == len(candidates) {
+			if saving.Cmp(bestSaving) > 0 {
+				copy(best, current)
+				bestSaving = saving
+			}
+			return
+		}
+		if saving.Add(remaining[i]).Cmp(bestSaving) <= 0 { // cannot beat the best combination found
+			return
+		}
+		if compatible(candidates, current, i) {
+			current[i] = true
+			search(i+1, saving.Add(candidates[i].saving))
+			current[i] = false
+		}
+		search(i+1, saving)
+	}
+	search(0, money.Money{})
+	return best
+}
+
+// sortedSKUs lists the SKUs of a product map in order
+func sortedSKUs(products map[string]*Product) []string {
+	skus := make([]string, 0, len(products))
+	for sku := range products {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+	return skus
+}
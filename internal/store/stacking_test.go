@@ -0,0 +1,161 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"reflect"
+	"testing"
+)
+
+func stackingPromotions() []*store.Promotion {
+	return []*store.Promotion{
+		{
+			Name:     "3 carrots for the price of 2",
+			SKU:      "3FOR2",
+			Category: "n4m",
+			Priority: 10,
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 3,
+			},
+			Rule: store.RuleDetail{
+				Count: 2,
+			},
+		},
+		{
+			Name:     "40% off carrots",
+			SKU:      "40OFF",
+			Category: "discount",
+			Requires: store.Requirement{
+				SKU:   "A1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".4"),
+			},
+		},
+		{
+			Name:     "10% off sticks",
+			SKU:      "10OFF",
+			Category: "discount",
+			Group:    "sticks",
+			Requires: store.Requirement{
+				SKU:   "B1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				Discount: money.MustParseRate(".1"),
+			},
+		},
+		{
+			Name:     "A carrot with every stick",
+			SKU:      "STICKCARROT",
+			Category: "freebie",
+			Group:    "sticks",
+			Priority: 5,
+			Requires: store.Requirement{
+				SKU:   "B1234",
+				Count: 1,
+			},
+			Rule: store.RuleDetail{
+				SKU:   "A1234",
+				Count: 1,
+			},
+		},
+	}
+}
+
+func promotionSKUs(view *store.CartView) []string {
+	skus := make([]string, 0)
+	for _, sku := range []string{"3FOR2", "40OFF", "10OFF", "STICKCARROT"} {
+		if _, ok := view.PromotionItems[sku]; ok {
+			skus = append(skus, sku)
+		}
+	}
+	return skus
+}
+
+func TestCart_ViewStacking(t *testing.T) {
+	tests := []struct {
+		strategy store.PromotionStrategy
+		applied  []string
+		skipped  []store.SkippedPromotion
+	}{
+		{
+			strategy: store.BestForCustomer,
+			applied:  []string{"40OFF", "STICKCARROT"},
+			skipped: []store.SkippedPromotion{
+				{SKU: "3FOR2", Name: "3 carrots for the price of 2", Reason: `does not stack with "40OFF" on SKU "A1234"`},
+				{SKU: "10OFF", Name: "10% off sticks", Reason: `only one promotion of group "sticks" applies and "STICKCARROT" was chosen`},
+			},
+		},
+		{
+			strategy: store.FirstByPriority,
+			applied:  []string{"3FOR2", "STICKCARROT"},
+			skipped: []store.SkippedPromotion{
+				{SKU: "40OFF", Name: "40% off carrots", Reason: `does not stack with "3FOR2" on SKU "A1234"`},
+				{SKU: "10OFF", Name: "10% off sticks", Reason: `only one promotion of group "sticks" applies and "STICKCARROT" was chosen`},
+			},
+		},
+	}
+	for _, test := range tests {
+		shop, c, err := setupShop()
+		if err != nil {
+			t.Fatalf("Test setup failed: %+v", err)
+		}
+		shop.SetPromotionStrategy(test.strategy)
+		if err := shop.RegisterPromotions(stackingPromotions()); err != nil {
+			t.Fatalf("Registering promotions failed: %+v", err)
+		}
+		errors := c.Update([]*store.Product{{SKU: "A1234", Count: 3}, {SKU: "B1234", Count: 1}})
+		if errors != nil {
+			t.Fatalf("Updating cart failed: %+v", errors)
+		}
+		view := c.View()
+		if view.Errors != nil {
+			t.Fatalf("Retrieving cart failed: %+v", view.Errors)
+		}
+		if applied := promotionSKUs(view); !reflect.DeepEqual(applied, test.applied) {
+			t.Errorf("Strategy %s applied unexpected promotions. Expected %+v, got %+v.", test.strategy, test.applied, applied)
+		}
+		skipped := make([]store.SkippedPromotion, 0)
+		for _, s := range view.Skipped {
+			skipped = append(skipped, *s)
+		}
+		if !reflect.DeepEqual(skipped, test.skipped) {
+			t.Errorf("Strategy %s skipped unexpected promotions. Expected %+v, got %+v.", test.strategy, test.skipped, skipped)
+		}
+	}
+}
+
+func TestCart_ViewStackable(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	promos := stackingPromotions()[:2]
+	for _, p := range promos {
+		p.Stackable = true
+	}
+	if err := shop.RegisterPromotions(promos); err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 3}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	view := c.View()
+	if applied := promotionSKUs(view); len(applied) != 2 || len(view.Skipped) != 0 {
+		t.Errorf("Stackable promotions not both applied. Got %+v, skipped %+v.", applied, view.Skipped)
+	}
+}
+
+func TestParsePromotionStrategy(t *testing.T) {
+	for in, expected := range map[string]store.PromotionStrategy{"best": store.BestForCustomer, "Priority": store.FirstByPriority} {
+		if strategy, err := store.ParsePromotionStrategy(in); err != nil || strategy != expected {
+			t.Errorf("Unexpected strategy for %q. Expected %s, got %s (%+v).", in, expected, strategy, err)
+		}
+	}
+	if _, err := store.ParsePromotionStrategy("random"); err == nil {
+		t.Error("Parsing an unknown strategy did not throw an error.")
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/money"
+)
+
+// PriceTier is a price break for buying at least MinCount of a product. The unit price in the tier is either a
+// fixed price or a discount off the list price. Neither means the list price.
+type PriceTier struct {
+	MinCount int         `yaml:"minCount"`
+	Discount money.Rate  `yaml:"discount,omitempty"`
+	Price    money.Money `yaml:"price,omitempty"`
+}
+
+// UnitPrice works out the unit price in the tier for a product with the given list price
+func (t PriceTier) UnitPrice(list money.Money) money.Money {
+	if !t.Price.IsZero() {
+		return t.Price
+	}
+	return list.Sub(list.Percent(t.Discount))
+}
+
+// validateTiers checks that price tiers are in order of their minimum count and in the product's currency
+func validateTiers(tiers []PriceTier, currency string) error {
+	previous := 0
+	for _, tier := range tiers {
+		if tier.MinCount <= previous {
+			return fmt.Errorf(`tiers must be in increasing order of minimum count, got %d after %d`, tier.MinCount, previous)
+		}
+		if tier.Discount < 0 || tier.Discount > money.RateScale || tier.Price.Amount < 0 {
+			return fmt.Errorf(`invalid price for tier from %d`, tier.MinCount)
+		}
+		if tier.Discount != 0 && !tier.Price.IsZero() {
+			return fmt.Errorf(`tier from %d has both a price and a discount`, tier.MinCount)
+		}
+		if !tier.Price.IsZero() && currency != "" && tier.Price.Currency != currency {
+			return fmt.Errorf(`tier from %d is priced in %s instead of %s`, tier.MinCount, tier.Price.Currency, currency)
+		}
+		previous = tier.MinCount
+	}
+	return nil
+}
+
+// tierFor finds the tier a count of a product falls into
+func tierFor(tiers []PriceTier, count int) (PriceTier, bool) {
+	var found PriceTier
+	ok := false
+	for _, tier := range tiers {
+		if count >= tier.MinCount {
+			found = tier
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// tierPromotion turns the price tiers of a product in the inventory into a promotion so they are applied like any
+// other volume discount
+func tierPromotion(product *Product) *Promotion {
+	return &Promotion{
+		Name:     fmt.Sprintf("Volume price for %s", product.Name),
+		SKU:      "TIERS-" + product.SKU,
+		Category: "tiered",
+		Requires: Requirement{
+			SKU:   product.SKU,
+			Count: 1,
+		},
+		Tiers: product.Tiers,
+	}
+}
+
+// applyTiers discounts every unit of a product to the unit price of the tier its count falls into
+func (p *Promotion) applyTiers(product *Product) (*Product, error) {
+	tier, ok := tierFor(p.Tiers, product.Count)
+	if !ok {
+		return nil, nil
+	}
+	if !tier.Price.IsZero() && tier.Price.Currency != product.Price.Currency {
+		return nil, fmt.Errorf(`promotion "%s" is in %s but SKU "%s" is priced in %s`, p.SKU, tier.Price.Currency, product.SKU, product.Price.Currency)
+	}
+	off := product.Price.Sub(tier.UnitPrice(product.Price))
+	if off.Cmp(off.Zero()) <= 0 {
+		return nil, nil
+	}
+	return &Product{
+		SKU:   p.SKU,
+		Name:  p.Name,
+		Price: off.Neg(),
+		Count: product.Count,
+	}, nil
+}
+
+// PriceTiers returns the price tiers of a product, either from the inventory or from a tiered promotion running
+// without a coupon code
+func (s *Shop) PriceTiers(product *Product) []PriceTier {
+	if len(product.Tiers) > 0 {
+		return product.Tiers
+	}
+	promos, err := s.promotions.All()
+	if err != nil {
+		return nil
+	}
+	now := s.clock.Now()
+	for _, promo := range promos {
+		if promo.Category == "tiered" && promo.Code == "" && promo.Requires.SKU == product.SKU && promo.activeAt(now) {
+			return promo.Tiers
+		}
+	}
+	return nil
+}
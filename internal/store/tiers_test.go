@@ -0,0 +1,145 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"reflect"
+	"testing"
+)
+
+func TestPriceTier_UnitPrice(t *testing.T) {
+	list := money.MustParse("109.5")
+	tiers := map[money.Money]store.PriceTier{
+		list:                     {MinCount: 1},
+		money.MustParse("96.36"): {MinCount: 10, Discount: money.MustParseRate(".12")},
+		money.MustParse("99"):    {MinCount: 20, Price: money.MustParse("99")},
+	}
+	for expected, tier := range tiers {
+		if price := tier.UnitPrice(list); price != expected {
+			t.Errorf("Unexpected unit price for tier %+v. Expected %s, got %s.", tier, expected, price)
+		}
+	}
+}
+
+func TestCart_GetPriceTiers(t *testing.T) {
+	shop := store.NewMemoryShop()
+	stock := []*store.Product{
+		{
+			SKU:   "A1234",
+			Name:  "Carrot",
+			Price: money.MustParse("1"),
+			Count: 20,
+			Tiers: []store.PriceTier{
+				{MinCount: 5, Discount: money.MustParseRate(".05")},
+				{MinCount: 10, Discount: money.MustParseRate(".12")},
+			},
+		},
+		{
+			SKU:   "B1234",
+			Name:  "Stick",
+			Price: money.MustParse("0.2"),
+			Count: 20,
+		},
+	}
+	if err := shop.StockShop(stock); err != nil {
+		t.Fatalf("Stocking shop failed: %+v", err)
+	}
+	err := shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "Cheap sticks in bulk",
+			SKU:      "BULKSTICKS",
+			Category: "tiered",
+			Requires: store.Requirement{
+				SKU: "B1234",
+			},
+			Tiers: []store.PriceTier{
+				{MinCount: 10, Price: money.MustParse("0.15")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	_, c := shop.RetrieveCart(nil)
+	counts := map[int]money.Money{
+		4:  money.MustParse("4"),
+		5:  money.MustParse("4.75"),
+		12: money.MustParse("10.56"),
+	}
+	for count, expected := range counts {
+		if errors := c.Update([]*store.Product{{SKU: "A1234", Count: count}}); errors != nil {
+			t.Fatalf("Updating cart failed: %+v", errors)
+		}
+		cartItems, promo, errors := c.Get()
+		if errors != nil {
+			t.Fatalf("Retrieving cart failed: %+v", errors)
+		}
+		if total := store.TotalPrice(cartItems, promo); total != expected {
+			t.Errorf("Unexpected total for %d carrots. Expected %s, got %s.", count, expected, total)
+		}
+	}
+
+	if errors := c.Update([]*store.Product{{SKU: "A1234", Count: 0}, {SKU: "B1234", Count: 10}}); errors != nil {
+		t.Fatalf("Updating cart failed: %+v", errors)
+	}
+	_, promo, _ := c.Get()
+	expected := &store.Product{
+		SKU:   "BULKSTICKS",
+		Name:  "Cheap sticks in bulk",
+		Price: money.MustParse("-0.05"),
+		Count: 10,
+	}
+	if !reflect.DeepEqual(promo["BULKSTICKS"], expected) {
+		t.Errorf("Tiered promotion not applied. Expected %+v, got %+v.", expected, promo["BULKSTICKS"])
+	}
+
+	inventory := shop.GetInventory()
+	if tiers := shop.PriceTiers(inventory["A1234"]); !reflect.DeepEqual(tiers, stock[0].Tiers) {
+		t.Errorf("Unexpected tiers from stock. Expected %+v, got %+v.", stock[0].Tiers, tiers)
+	}
+	if tiers := shop.PriceTiers(inventory["B1234"]); len(tiers) != 1 || tiers[0].MinCount != 10 {
+		t.Errorf("Unexpected tiers from promotion: %+v", tiers)
+	}
+}
+
+func TestStockShop_InvalidTiers(t *testing.T) {
+	shop := store.NewMemoryShop()
+	invalid := [][]store.PriceTier{
+		{{MinCount: 10}, {MinCount: 5}},
+		{{MinCount: 0}},
+		{{MinCount: 5, Discount: money.MustParseRate(".1"), Price: money.MustParse("1")}},
+		{{MinCount: 5, Price: money.MustParse("1 EUR")}},
+	}
+	for _, tiers := range invalid {
+		stock := []*store.Product{{SKU: "A1234", Price: money.MustParse("2"), Count: 1, Tiers: tiers}}
+		if err := shop.StockShop(stock); err == nil {
+			t.Errorf("Stocking product with tiers %+v did not throw an error.", tiers)
+		}
+	}
+}
+
+func TestCart_GetForeignTiers(t *testing.T) {
+	shop, c, err := setupShop()
+	if err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	promo := &store.Promotion{
+		Name:     "Carrots for a euro",
+		SKU:      "EUROCARROTS",
+		Category: "tiered",
+		Requires: store.Requirement{SKU: "A1234"},
+		Tiers:    []store.PriceTier{{MinCount: 2, Price: money.MustParse("1 EUR")}},
+	}
+	if err := shop.CreatePromotion(promo); err == nil {
+		t.Error("Creating a tiered promotion priced in another currency did not throw an error.")
+	}
+	if err := shop.RegisterPromotions([]*store.Promotion{promo}); err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	if err := c.Add(&store.Product{SKU: "A1234", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promos, errors := c.Get(); len(promos) != 0 || len(errors) == 0 {
+		t.Errorf("Tiers in another currency applied or not reported: %+v (%+v)", promos, errors)
+	}
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/money"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ResolveVariants copies the products of an inventory with every variant taking the details it leaves out from its
+// parent. Other products and variants whose parent is missing are copied unchanged.
+func ResolveVariants(stock []*Product) []*Product {
+	parents := make(map[string]*Product, len(stock))
+	for _, p := range stock {
+		if p != nil {
+			parents[p.SKU] = p
+		}
+	}
+	resolved := make([]*Product, 0, len(stock))
+	for _, p := range stock {
+		if p == nil {
+			resolved = append(resolved, nil)
+			continue
+		}
+		variant := *p
+		if parent, ok := parents[p.Parent]; ok && p.Parent != "" {
+			resolveVariant(&variant, parent)
+		}
+		resolved = append(resolved, &variant)
+	}
+	return resolved
+}
+
+// resolveVariant fills in the details a variant leaves out from its parent. Its attributes are added to the
+// parent's and, if it has no name, the values of its own attributes are added to the parent's name, e.g.
+// "Google Home - chalk".
+func resolveVariant(variant, parent *Product) {
+	if variant.Name == "" {
+		variant.Name = parent.Name
+		if len(variant.Attributes) > 0 {
+			names := make([]string, 0, len(variant.Attributes))
+			for name := range variant.Attributes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			values := make([]string, 0, len(names))
+			for _, name := range names {
+				values = append(values, variant.Attributes[name])
+			}
+			variant.Name = fmt.Sprintf("%s - %s", parent.Name, strings.Join(values, " / "))
+		}
+	}
+	if variant.Price == (money.Money{}) {
+		variant.Price = parent.Price
+	}
+	if variant.LowStock == 0 {
+		variant.LowStock = parent.LowStock
+	}
+	if variant.Tiers == nil {
+		variant.Tiers = parent.Tiers
+	}
+	if variant.Brand == "" {
+		variant.Brand = parent.Brand
+	}
+	if variant.Description == "" {
+		variant.Description = parent.Description
+	}
+	if variant.Categories == nil {
+		variant.Categories = parent.Categories
+	}
+	if variant.Images == nil {
+		variant.Images = parent.Images
+	}
+	if len(parent.Attributes) > 0 {
+		attributes := make(map[string]string, len(parent.Attributes)+len(variant.Attributes))
+		for name, value := range parent.Attributes {
+			attributes[name] = value
+		}
+		for name, value := range variant.Attributes {
+			attributes[name] = value
+		}
+		variant.Attributes = attributes
+	}
+}
+
+// reresolveVariant updates the details a resolved variant took from its parent after the parent changed. Details
+// equal to those it would have taken from the parent before the change count as taken from it.
+func reresolveVariant(variant, before, after *Product) {
+	own := *variant
+	own.Attributes = make(map[string]string)
+	for name, value := range variant.Attributes {
+		if parentValue, ok := before.Attributes[name]; !ok || parentValue != value {
+			own.Attributes[name] = value
+		}
+	}
+	if len(own.Attributes) == 0 {
+		own.Attributes = nil
+	}
+	inherited := Product{Attributes: own.Attributes}
+	resolveVariant(&inherited, before)
+	if own.Name == inherited.Name {
+		own.Name = ""
+	}
+	if own.Price == inherited.Price {
+		own.Price = money.Money{}
+	}
+	if own.LowStock == inherited.LowStock {
+		own.LowStock = 0
+	}
+	if reflect.DeepEqual(own.Tiers, inherited.Tiers) {
+		own.Tiers = nil
+	}
+	if own.Brand == inherited.Brand {
+		own.Brand = ""
+	}
+	if own.Description == inherited.Description {
+		own.Description = ""
+	}
+	if reflect.DeepEqual(own.Categories, inherited.Categories) {
+		own.Categories = nil
+	}
+	if reflect.DeepEqual(own.Images, inherited.Images) {
+		own.Images = nil
+	}
+	resolveVariant(&own, after)
+	*variant = own
+}
+
+// checkVariant checks that the parent of a variant is in the inventory and is not a variant itself
+func checkVariant(products map[string]*Product, variant *Product) error {
+	if variant.Parent == "" {
+		return nil
+	}
+	parent, ok := products[variant.Parent]
+	switch {
+	case variant.Parent == variant.SKU:
+		return fmt.Errorf(`SKU "%s" is its own parent`, variant.SKU)
+	case !ok:
+		return fmt.Errorf(`parent "%s" of SKU "%s" does not exist`, variant.Parent, variant.SKU)
+	case parent.Parent != "":
+		return fmt.Errorf(`parent "%s" of SKU "%s" is a variant itself`, variant.Parent, variant.SKU)
+	}
+	return nil
+}
+
+// checkVariants checks the parents of all variants in an inventory
+func checkVariants(products map[string]*Product) error {
+	for _, sku := range sortedSKUs(products) {
+		if err := checkVariant(products, products[sku]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetedParents lists the parents a promotion targets which have variants in a cart. Cart promotions count
+// variants towards their parent themselves, so they target none.
+func (p *Promotion) targetedParents(contents map[string]*Product) map[string]bool {
+	targets := make(map[string]bool)
+	switch p.Category {
+	case "cart":
+	case "bundle":
+		for _, item := range p.Bundle {
+			targets[item.SKU] = true
+		}
+	default:
+		targets[p.Requires.SKU] = true
+	}
+	parents := make(map[string]bool)
+	for _, product := range contents {
+		if product.Parent != "" && targets[product.Parent] {
+			parents[product.Parent] = true
+		}
+	}
+	return parents
+}
+
+// promotionContents prepares a cart's contents for a promotion. Variants of a parent the promotion targets are
+// rolled up into their parent, so any mix of variants qualifies. The rolled up product is valued at the price of
+// its cheapest variant, which is the one made free by an n4m promotion. Discount and tiered promotions are worked
+// out per variant by applyVariants.
+func (p *Promotion) promotionContents(contents map[string]*Product) map[string]*Product {
+	parents := p.targetedParents(contents)
+	if len(parents) == 0 {
+		return contents
+	}
+	rolledUp := make(map[string]*Product, len(contents))
+	for _, sku := range sortedSKUs(contents) {
+		product := contents[sku]
+		key := product.SKU
+		if product.Parent != "" && parents[product.Parent] {
+			key = product.Parent
+		}
+		existing, ok := rolledUp[key]
+		if !ok {
+			rollUp := *product
+			rollUp.SKU = key
+			rollUp.Parent = ""
+			rolledUp[key] = &rollUp
+			continue
+		}
+		existing.Count += product.Count
+		if product.Price.Cmp(existing.Price) < 0 {
+			existing.Price = product.Price
+		}
+	}
+	return rolledUp
+}
+
+// applyVariants applies a discount or tiered promotion to a parent rolled up from its variants in a cart. The mix
+// of variants qualifies, and reaches a tier, by its total count, but each variant is discounted from its own price.
+// Unless every unit is discounted by the same amount, the saving is returned as a single item.
+func (p *Promotion) applyVariants(rolledUp *Product, contents map[string]*Product) (*Product, error) {
+	var unitOff, totalOff money.Money
+	discounted, sameOff := false, true
+	for _, sku := range sortedSKUs(contents) {
+		product := contents[sku]
+		if product.SKU != rolledUp.SKU && product.Parent != rolledUp.SKU {
+			continue
+		}
+		priced := *rolledUp
+		priced.Price = product.Price
+		_, item, err := p.Apply(&priced)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil || item.Count <= 0 {
+			continue
+		}
+		if !discounted {
+			discounted, unitOff, totalOff = true, item.Price, item.Price.Mul(int64(product.Count))
+			continue
+		}
+		sameOff = sameOff && item.Price == unitOff
+		totalOff = totalOff.Add(item.Price.Mul(int64(product.Count)))
+	}
+	if !discounted {
+		return nil, nil
+	}
+	if sameOff {
+		return &Product{SKU: p.SKU, Name: p.Name, Price: unitOff, Count: rolledUp.Count}, nil
+	}
+	return &Product{SKU: p.SKU, Name: p.Name, Price: totalOff, Count: 1}, nil
+}
+
+// expandParents replaces parents in a list of SKUs by the variants of them in a cart
+func expandParents(skus []string, contents map[string]*Product) []string {
+	expanded := make([]string, 0, len(skus))
+	for _, sku := range skus {
+		variants := make([]string, 0)
+		for _, variantSku := range sortedSKUs(contents) {
+			if contents[variantSku].Parent == sku {
+				variants = append(variants, variantSku)
+			}
+		}
+		if _, ok := contents[sku]; ok || len(variants) == 0 {
+			expanded = append(expanded, sku)
+		}
+		expanded = append(expanded, variants...)
+	}
+	sort.Strings(expanded)
+	return expanded
+}
@@ -0,0 +1,215 @@
+package store_test
+
+import (
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"reflect"
+	"testing"
+)
+
+func variantStock() []*store.Product {
+	return []*store.Product{
+		{
+			SKU:        "H1234",
+			Name:       "Speaker",
+			Price:      money.MustParse("50"),
+			Brand:      "Acme",
+			Categories: []string{"Speakers"},
+			Attributes: map[string]string{"connectivity": "Wi-Fi"},
+		},
+		{
+			SKU:        "H1234-CH",
+			Parent:     "H1234",
+			Count:      5,
+			Attributes: map[string]string{"colour": "chalk"},
+		},
+		{
+			SKU:        "H1234-CC",
+			Parent:     "H1234",
+			Price:      money.MustParse("55"),
+			Count:      5,
+			Attributes: map[string]string{"colour": "charcoal"},
+		},
+	}
+}
+
+func TestResolveVariants(t *testing.T) {
+	resolved := store.ResolveVariants(variantStock())
+	expected := &store.Product{
+		SKU:        "H1234-CH",
+		Name:       "Speaker - chalk",
+		Price:      money.MustParse("50"),
+		Count:      5,
+		Parent:     "H1234",
+		Brand:      "Acme",
+		Categories: []string{"Speakers"},
+		Attributes: map[string]string{"colour": "chalk", "connectivity": "Wi-Fi"},
+	}
+	if !reflect.DeepEqual(resolved[1], expected) {
+		t.Errorf("Variant not resolved. Expected %+v, got %+v.", expected, resolved[1])
+	}
+	if resolved[2].Price != money.MustParse("55") {
+		t.Errorf("Price override lost. Expected 55.00 USD, got %s.", resolved[2].Price)
+	}
+	if again := store.ResolveVariants(resolved); !reflect.DeepEqual(again, resolved) {
+		t.Errorf("Resolving variants twice changed them. Expected %+v, got %+v.", resolved, again)
+	}
+}
+
+func TestStockShop_Variants(t *testing.T) {
+	shop := store.NewMemoryShop()
+	stock := variantStock()
+	stock[0].Parent = "H1234-CH"
+	if err := shop.StockShop(stock); err == nil {
+		t.Error("Stocking shop didn't fail for a parent which is a variant.")
+	}
+	stock[0].Parent = ""
+	stock[1].Parent = "Z9999"
+	if err := shop.StockShop(stock); err == nil {
+		t.Error("Stocking shop didn't fail for a missing parent.")
+	}
+	if err := shop.StockShop(variantStock()); err != nil {
+		t.Fatalf("Stocking shop failed: %+v", err)
+	}
+	if _, err := shop.CreateProduct(&store.Product{SKU: "H1234-WH", Parent: "H1234", Count: 1}); err != nil {
+		t.Fatalf("Creating variant failed: %+v", err)
+	}
+	if created := shop.GetInventory()["H1234-WH"]; created.Price != money.MustParse("50") || created.Name != "Speaker" {
+		t.Errorf("Created variant not resolved: %+v", created)
+	}
+
+	name, price := "Smart speaker", money.MustParse("60")
+	if _, err := shop.UpdateProduct("H1234", store.ProductUpdate{Name: &name, Price: &price}); err != nil {
+		t.Fatalf("Updating parent failed: %+v", err)
+	}
+	inventory := shop.GetInventory()
+	if chalk := inventory["H1234-CH"]; chalk.Name != "Smart speaker - chalk" || chalk.Price != price {
+		t.Errorf("Variant did not take the parent's changes: %+v", chalk)
+	}
+	if charcoal := inventory["H1234-CC"]; charcoal.Price != money.MustParse("55") {
+		t.Errorf("Price override lost. Expected 55.00 USD, got %s.", charcoal.Price)
+	}
+}
+
+func TestCart_GetVariantPromotions(t *testing.T) {
+	shop := store.NewMemoryShop()
+	if err := shop.StockShop(variantStock()); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err := shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "3 speakers for the price of 2",
+			SKU:      "3FOR2",
+			Category: "n4m",
+			Requires: store.Requirement{SKU: "H1234", Count: 3},
+			Rule:     store.RuleDetail{Count: 2},
+		},
+		{
+			Name:      "10% off charcoal",
+			SKU:       "CHARCOAL",
+			Category:  "discount",
+			Requires:  store.Requirement{SKU: "H1234-CC", Count: 1},
+			Rule:      store.RuleDetail{Discount: money.MustParseRate(".1")},
+			Stackable: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	_, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "H1234-CH", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promos, _ := cart.Get(); len(promos) != 0 {
+		t.Errorf("Promotion applied without enough variants: %+v", promos)
+	}
+	if err := cart.Add(&store.Product{SKU: "H1234-CC", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	_, promos, errors := cart.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	expected := &store.Product{SKU: "3FOR2", Name: "3 speakers for the price of 2", Price: money.MustParse("-50"), Count: 1}
+	if !reflect.DeepEqual(promos["3FOR2"], expected) {
+		t.Errorf("Parent promotion not applied to a mix of variants. Expected %+v, got %+v.", expected, promos["3FOR2"])
+	}
+	if promos["CHARCOAL"] != nil {
+		t.Errorf("Variant promotion applied although it conflicts with the parent promotion: %+v", promos["CHARCOAL"])
+	}
+
+	_, other := shop.RetrieveCart(nil)
+	if err := other.Add(&store.Product{SKU: "H1234-CH", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promos, _ := other.Get(); len(promos) != 0 {
+		t.Errorf("Variant promotion applied to another variant: %+v", promos)
+	}
+	if err := other.Add(&store.Product{SKU: "H1234-CC", Count: 1}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	if _, promos, _ := other.Get(); promos["CHARCOAL"] == nil || promos["CHARCOAL"].Price != money.MustParse("-5.5") {
+		t.Errorf("Variant promotion not applied: %+v", promos["CHARCOAL"])
+	}
+}
+
+func TestCart_GetVariantDiscounts(t *testing.T) {
+	shop := store.NewMemoryShop()
+	stock := variantStock()
+	stock[0].Price = money.MustParse("10")
+	stock[2].Price = money.MustParse("50")
+	if err := shop.StockShop(stock); err != nil {
+		t.Fatalf("Test setup failed: %+v", err)
+	}
+	err := shop.RegisterPromotions([]*store.Promotion{
+		{
+			Name:     "20% off 2 speakers",
+			SKU:      "20OFF",
+			Category: "discount",
+			Requires: store.Requirement{SKU: "H1234", Count: 2},
+			Rule:     store.RuleDetail{Discount: money.MustParseRate(".2")},
+		},
+		{
+			Name:      "Speaker volume discount",
+			SKU:       "SPEAKERTIERS",
+			Category:  "tiered",
+			Requires:  store.Requirement{SKU: "H1234"},
+			Tiers:     []store.PriceTier{{MinCount: 2, Discount: money.MustParseRate(".1")}},
+			Stackable: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Registering promotions failed: %+v", err)
+	}
+	_, cart := shop.RetrieveCart(nil)
+	if err := cart.Add(&store.Product{SKU: "H1234-CH", Count: 2}); err != nil {
+		t.Fatalf("Adding to cart failed: %+v", err)
+	}
+	_, promos, _ := cart.Get()
+	expected := &store.Product{SKU: "20OFF", Name: "20% off 2 speakers", Price: money.MustParse("-2"), Count: 2}
+	if !reflect.DeepEqual(promos["20OFF"], expected) {
+		t.Errorf("Unexpected discount on a single variant. Expected %+v, got %+v.", expected, promos["20OFF"])
+	}
+	if errors := cart.Update([]*store.Product{{SKU: "H1234-CH", Count: 1}, {SKU: "H1234-CC", Count: 1}}); errors != nil {
+		t.Fatalf("Updating cart failed: %+v", errors)
+	}
+	_, promos, errors := cart.Get()
+	if errors != nil {
+		t.Fatalf("Retrieving cart failed: %+v", errors)
+	}
+	expected = &store.Product{SKU: "20OFF", Name: "20% off 2 speakers", Price: money.MustParse("-12"), Count: 1}
+	if !reflect.DeepEqual(promos["20OFF"], expected) {
+		t.Errorf("Discount not worked out per variant. Expected %+v, got %+v.", expected, promos["20OFF"])
+	}
+	if promos["SPEAKERTIERS"] != nil {
+		t.Errorf("Tiered promotion applied although it conflicts with the discount: %+v", promos["SPEAKERTIERS"])
+	}
+
+	if _, err := shop.DeletePromotion("20OFF"); err != nil {
+		t.Fatalf("Deleting promotion failed: %+v", err)
+	}
+	expected = &store.Product{SKU: "SPEAKERTIERS", Name: "Speaker volume discount", Price: money.MustParse("-6"), Count: 1}
+	if _, promos, _ := cart.Get(); !reflect.DeepEqual(promos["SPEAKERTIERS"], expected) {
+		t.Errorf("Tiers not worked out per variant. Expected %+v, got %+v.", expected, promos["SPEAKERTIERS"])
+	}
+}
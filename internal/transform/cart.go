@@ -3,43 +3,55 @@ package transform
 import (
 	"github.com/google/uuid"
 	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/money"
 	"github.com/jsfan/fake-shop/internal/store"
 )
 
 // RefreshCart refreshes a cart ready for delivery to the frontend
 func RefreshCart(cartUUID string, cart *store.Cart) (*model.Cart, error) {
-	regular, promo, errorList := cart.Get()
+	view := cart.View()
+	regular, promo, errorList := view.Items, view.PromotionItems, view.Errors
 	outCart := &model.Cart{
-		ID:             cartUUID,
-		AddedItems:     nil,
-		PromotionItems: nil,
-		TotalPrice:     0,
-		Errors:         nil,
+		ID:                 cartUUID,
+		AddedItems:         nil,
+		PromotionItems:     nil,
+		Lines:              make([]*model.CartLine, 0, len(view.Lines)),
+		PromotionLines:     make([]*model.CartLine, 0, len(view.PromotionLines)),
+		TotalPrice:         money.Money{},
+		Coupons:            cart.Coupons(),
+		AppliedPromotions:  convertExplanations(view.Applied, true),
+		RejectedPromotions: convertExplanations(view.Rejected, false),
+		Errors:             nil,
 	}
-	total := 0.
 	if regular != nil {
 		outCart.AddedItems = make([]*model.Product, 0)
-		for _, p := range regular {
-			outCart.AddedItems = append(outCart.AddedItems, &model.Product{
-				Sku:   p.SKU,
-				Name:  p.Name,
-				Price: p.Price,
-				Count: &p.Count,
-			})
-			total += p.Price * float64(p.Count)
+	}
+	for _, line := range view.Lines {
+		p := line.Product
+		product := &model.Product{
+			Sku:          p.SKU,
+			Name:         p.Name,
+			Price:        p.Price,
+			Count:        &p.Count,
+			PriceTiers:   convertTiers(p.Price, p.Tiers),
+			Availability: convertAvailability(line.Availability),
 		}
+		outCart.AddedItems = append(outCart.AddedItems, product)
+		outCart.Lines = append(outCart.Lines, &model.CartLine{ID: line.ID, Product: product})
 	}
 	if promo != nil {
 		outCart.PromotionItems = make([]*model.Product, 0)
-		for _, p := range promo {
-			outCart.PromotionItems = append(outCart.PromotionItems, &model.Product{
-				Sku:   p.SKU,
-				Name:  p.Name,
-				Price: p.Price,
-				Count: &p.Count,
-			})
-			total += p.Price * float64(p.Count)
+	}
+	for _, line := range view.PromotionLines {
+		p := line.Product
+		product := &model.Product{
+			Sku:   p.SKU,
+			Name:  p.Name,
+			Price: p.Price,
+			Count: &p.Count,
 		}
+		outCart.PromotionItems = append(outCart.PromotionItems, product)
+		outCart.PromotionLines = append(outCart.PromotionLines, &model.CartLine{ID: line.ID, Product: product})
 	}
 	if errorList != nil {
 		outCart.Errors = make([]string, 0)
@@ -47,12 +59,24 @@ func RefreshCart(cartUUID string, cart *store.Cart) (*model.Cart, error) {
 			outCart.Errors = append(outCart.Errors, e.Error())
 		}
 	}
-	outCart.TotalPrice = total
+	outCart.TotalPrice = store.TotalPrice(regular, promo)
 	return outCart, nil
 }
 
+// AddErrors adds errors which occurred while changing a cart ahead of the cart's own errors
+func AddErrors(outCart *model.Cart, errorList ...error) {
+	if len(errorList) == 0 {
+		return
+	}
+	errorStrings := make([]string, 0)
+	for _, e := range errorList {
+		errorStrings = append(errorStrings, e.Error())
+	}
+	outCart.Errors = append(errorStrings, outCart.Errors...)
+}
+
 // LoadCart loads a cart with products requested from the frontend
-func LoadCart(inCart model.NewCart) (*store.Cart, []error, error) {
+func LoadCart(shop *store.Shop, inCart model.NewCart) (*store.Cart, []error, error) {
 	cartId := inCart.CartID
 	cartUUID := uuid.New()
 	if cartId != nil {
@@ -61,7 +85,7 @@ func LoadCart(inCart model.NewCart) (*store.Cart, []error, error) {
 			return nil, nil, err
 		}
 	}
-	_, outCart := store.RetrieveCart(&cartUUID)
+	_, outCart := shop.RetrieveCart(&cartUUID)
 	newItems := make([]*store.Product, 0)
 	for _, p := range inCart.Products {
 		newItems = append(newItems, &store.Product{
@@ -73,17 +97,41 @@ func LoadCart(inCart model.NewCart) (*store.Cart, []error, error) {
 	return outCart, errorList, nil
 }
 
-// FilterInventory filters the inventory to not contain counts
-func FilterInventory() []*model.Product {
-	inventory := store.GetInventory()
-	filtered := make([]*model.Product, 0)
-	for _, p := range inventory {
-		filtered = append(filtered, &model.Product{
-			Sku:   p.SKU,
-			Name:  p.Name,
-			Price: p.Price,
-			Count: nil,
+// convertTiers converts the price tiers of a product with the given list price
+func convertTiers(list money.Money, tiers []store.PriceTier) []*model.PriceTier {
+	if len(tiers) == 0 {
+		return nil
+	}
+	converted := make([]*model.PriceTier, 0, len(tiers))
+	for _, tier := range tiers {
+		converted = append(converted, &model.PriceTier{
+			MinCount:  tier.MinCount,
+			UnitPrice: tier.UnitPrice(list),
 		})
 	}
-	return filtered
+	return converted
+}
+
+// convertExplanations converts the explanations of applied or rejected promotions
+func convertExplanations(explanations []*store.PromotionExplanation, applied bool) []*model.PromotionExplanation {
+	converted := make([]*model.PromotionExplanation, 0, len(explanations))
+	for _, e := range explanations {
+		out := &model.PromotionExplanation{
+			Sku:             e.SKU,
+			Name:            e.Name,
+			Category:        e.Category,
+			Requirement:     e.Requirement,
+			QualifyingCount: e.Qualifying,
+		}
+		if applied {
+			saving := e.Saving
+			out.Saving = &saving
+		}
+		if e.Reason != "" {
+			reason := e.Reason
+			out.Reason = &reason
+		}
+		converted = append(converted, out)
+	}
+	return converted
 }
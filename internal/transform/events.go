@@ -0,0 +1,56 @@
+package transform
+
+import (
+	"context"
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/store"
+)
+
+var eventTypes = map[store.CartEventKind]model.CartEventType{
+	store.CartExpiryWarning: model.CartEventTypeExpiryWarning,
+	store.CartExpired:       model.CartEventTypeExpired,
+	store.CartStockReleased: model.CartEventTypeStockReleased,
+	store.CartCheckedOut:    model.CartEventTypeCheckedOut,
+}
+
+// ConvertCartEvent converts a cart lifecycle event for delivery to the frontend
+func ConvertCartEvent(event store.CartEvent) *model.CartEvent {
+	outEvent := &model.CartEvent{
+		CartID:        event.CartID.String(),
+		Type:          eventTypes[event.Kind],
+		ExpiresAt:     event.Expires,
+		ReleasedItems: nil,
+	}
+	if event.Released != nil {
+		outEvent.ReleasedItems = convertProducts(event.Released)
+	}
+	return outEvent
+}
+
+// StreamCartEvents forwards cart events to the frontend until the cart is gone or the context ends
+func StreamCartEvents(ctx context.Context, events <-chan store.CartEvent, unsubscribe func()) <-chan *model.CartEvent {
+	outEvents := make(chan *model.CartEvent, 1)
+	go func() {
+		defer close(outEvents)
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case outEvents <- ConvertCartEvent(event):
+				case <-ctx.Done():
+					return
+				}
+				if event.Kind == store.CartStockReleased || event.Kind == store.CartCheckedOut { // the cart is gone, so no further events will follow
+					return
+				}
+			}
+		}
+	}()
+	return outEvents
+}
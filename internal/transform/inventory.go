@@ -0,0 +1,242 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"sort"
+)
+
+var availabilities = map[store.Availability]model.Availability{
+	store.InStock:     model.AvailabilityInStock,
+	store.LowStock:    model.AvailabilityLowStock,
+	store.OutOfStock:  model.AvailabilityOutOfStock,
+	store.OnBackorder: model.AvailabilityBackorder,
+}
+
+// convertAvailability converts how available a product is
+func convertAvailability(availability store.Availability) *model.Availability {
+	converted := availabilities[availability]
+	return &converted
+}
+
+// ConvertProduct converts a product in the inventory including its count and availability
+func ConvertProduct(p *store.Product) *model.Product {
+	converted := convertItem(p)
+	converted.Availability = convertAvailability(p.Availability())
+	return converted
+}
+
+// convertItem converts a product including its count. Items such as those ordered are copies whose counts are not
+// stock levels, so they have no availability.
+func convertItem(p *store.Product) *model.Product {
+	count := p.Count
+	return withCatalogue(&model.Product{
+		Sku:          p.SKU,
+		Name:         p.Name,
+		Price:        p.Price,
+		Count:        &count,
+		PriceTiers:   convertTiers(p.Price, p.Tiers),
+		Discontinued: p.Discontinued,
+		ParentSku:    optionalSKU(p.Parent),
+	}, p)
+}
+
+// ListedProduct converts a product for its product page including its variants. Products which are not sold are
+// not found.
+func ListedProduct(shop *store.Shop, sku string) *model.Product {
+	inventory := shop.GetInventory()
+	p, ok := inventory[sku]
+	if !ok || p.Discontinued {
+		return nil
+	}
+	return convertListing(shop, inventory, p)
+}
+
+// convertListing converts a product as customers see it, with its availability instead of its stock and with any
+// tiered promotion. The variants still sold are listed in order of SKU.
+func convertListing(shop *store.Shop, inventory map[string]*store.Product, p *store.Product) *model.Product {
+	listing := withCatalogue(&model.Product{
+		Sku:        p.SKU,
+		Name:       p.Name,
+		Price:      p.Price,
+		Count:      nil,
+		PriceTiers: convertTiers(p.Price, shop.PriceTiers(p)),
+		ParentSku:  optionalSKU(p.Parent),
+	}, p)
+	availability := p.Availability()
+	for _, variant := range inventory {
+		if variant.Parent == p.SKU && !variant.Discontinued {
+			listing.Variants = append(listing.Variants, convertListing(shop, inventory, variant))
+			if variant.Availability() > availability {
+				availability = variant.Availability()
+			}
+		}
+	}
+	listing.Availability = convertAvailability(availability)
+	sort.Slice(listing.Variants, func(i, j int) bool {
+		return listing.Variants[i].Sku < listing.Variants[j].Sku
+	})
+	return listing
+}
+
+// optionalSKU converts a reference to another product which is unset when empty
+func optionalSKU(sku string) *string {
+	if sku == "" {
+		return nil
+	}
+	return &sku
+}
+
+// withCatalogue adds the details shown on a product page to a converted product
+func withCatalogue(converted *model.Product, p *store.Product) *model.Product {
+	if p.Brand != "" {
+		brand := p.Brand
+		converted.Brand = &brand
+	}
+	if p.Description != "" {
+		description := p.Description
+		converted.Description = &description
+	}
+	converted.Categories = p.Categories
+	converted.Images = p.Images
+	if len(p.Attributes) > 0 {
+		converted.Attributes = make([]*model.Attribute, 0, len(p.Attributes))
+		for name, value := range p.Attributes {
+			converted.Attributes = append(converted.Attributes, &model.Attribute{Name: name, Value: value})
+		}
+		sort.Slice(converted.Attributes, func(i, j int) bool {
+			return converted.Attributes[i].Name < converted.Attributes[j].Name
+		})
+	}
+	return converted
+}
+
+// AdminInventory lists the whole inventory in order of SKU including counts and discontinued products
+func AdminInventory(shop *store.Shop) []*model.Product {
+	inventory := shop.GetInventory()
+	products := make([]*model.Product, 0, len(inventory))
+	for _, p := range inventory {
+		products = append(products, ConvertProduct(p))
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].Sku < products[j].Sku
+	})
+	return products
+}
+
+// LoadProduct converts a new product from an admin. Variants may leave out their price and catalogue details to
+// take them from their parent.
+func LoadProduct(input model.NewProduct) (*store.Product, error) {
+	tiers, err := loadTiers(input.PriceTiers)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := loadAttributes(input.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	product := &store.Product{
+		SKU:        input.Sku,
+		Name:       input.Name,
+		Count:      input.Count,
+		Tiers:      tiers,
+		Categories: input.Categories,
+		Images:     input.Images,
+		Attributes: attributes,
+	}
+	if input.Price != nil {
+		product.Price = *input.Price
+	}
+	if input.ParentSku != nil {
+		product.Parent = *input.ParentSku
+	}
+	if input.LowStock != nil {
+		product.LowStock = *input.LowStock
+	}
+	if input.Backorder != nil {
+		product.Backorder = *input.Backorder
+	}
+	if input.Brand != nil {
+		product.Brand = *input.Brand
+	}
+	if input.Description != nil {
+		product.Description = *input.Description
+	}
+	return product, nil
+}
+
+// LoadProductUpdate converts changes to a product from an admin
+func LoadProductUpdate(input model.ProductUpdate) (store.ProductUpdate, error) {
+	update := store.ProductUpdate{
+		Name:        input.Name,
+		Price:       input.Price,
+		LowStock:    input.LowStock,
+		Backorder:   input.Backorder,
+		Brand:       input.Brand,
+		Description: input.Description,
+	}
+	if input.Categories != nil {
+		update.Categories = &input.Categories
+	}
+	if input.Images != nil {
+		update.Images = &input.Images
+	}
+	if input.Attributes != nil {
+		attributes, err := loadAttributes(input.Attributes)
+		if err != nil {
+			return update, err
+		}
+		update.Attributes = &attributes
+	}
+	if input.PriceTiers != nil {
+		tiers, err := loadTiers(input.PriceTiers)
+		if err != nil {
+			return update, err
+		}
+		update.Tiers = &tiers
+	}
+	return update, nil
+}
+
+// loadAttributes converts a list of free-form product attributes, each of which may only be given once
+func loadAttributes(inputs []*model.AttributeInput) (map[string]string, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	attributes := make(map[string]string, len(inputs))
+	for _, in := range inputs {
+		if _, ok := attributes[in.Name]; ok {
+			return nil, fmt.Errorf(`attribute "%s" given twice`, in.Name)
+		}
+		attributes[in.Name] = in.Value
+	}
+	return attributes, nil
+}
+
+// loadTiers converts price tiers which either set a unit price or a discount off the list price
+func loadTiers(inputs []*model.PriceTierInput) ([]store.PriceTier, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	tiers := make([]store.PriceTier, 0, len(inputs))
+	for _, in := range inputs {
+		tier := store.PriceTier{MinCount: in.MinCount}
+		if (in.UnitPrice == nil) == (in.Discount == nil) {
+			return nil, errors.New("price tiers need either a unit price or a discount")
+		}
+		if in.UnitPrice != nil {
+			tier.Price = *in.UnitPrice
+		} else {
+			discount, err := money.ParseRate(*in.Discount)
+			if err != nil {
+				return nil, err
+			}
+			tier.Discount = discount
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
@@ -0,0 +1,27 @@
+package transform
+
+import (
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/store"
+)
+
+// ConvertOrder converts an order for delivery to the frontend
+func ConvertOrder(order *store.Order) *model.Order {
+	return &model.Order{
+		ID:             order.ID.String(),
+		Items:          convertProducts(order.Items),
+		PromotionItems: convertProducts(order.PromotionItems),
+		Subtotal:       order.Subtotal,
+		TotalPrice:     order.Total,
+		PlacedAt:       order.Placed,
+	}
+}
+
+// convertProducts converts a list of products including their counts
+func convertProducts(products []*store.Product) []*model.Product {
+	converted := make([]*model.Product, 0, len(products))
+	for _, p := range products {
+		converted = append(converted, convertItem(p))
+	}
+	return converted
+}
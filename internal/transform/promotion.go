@@ -0,0 +1,182 @@
+package transform
+
+import (
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"time"
+)
+
+// ConvertPromotion converts a promotion for advertising or managing it
+func ConvertPromotion(p *store.Promotion) *model.Promotion {
+	promo := &model.Promotion{
+		Sku:         p.SKU,
+		Name:        p.Name,
+		Category:    p.Category,
+		Requirement: p.DescribeRequirement(),
+		Enabled:     !p.Disabled,
+		ValidFrom:   optionalTime(p.ValidFrom),
+		ValidUntil:  optionalTime(p.ValidUntil),
+		Priority:    p.Priority,
+		Stackable:   p.Stackable,
+	}
+	if p.Code != "" {
+		code := p.Code
+		promo.Code = &code
+	}
+	if p.Group != "" {
+		group := p.Group
+		promo.Group = &group
+	}
+	return promo
+}
+
+// ConvertPromotions converts a list of promotions keeping their order
+func ConvertPromotions(promos []*store.Promotion) []*model.Promotion {
+	converted := make([]*model.Promotion, 0, len(promos))
+	for _, p := range promos {
+		converted = append(converted, ConvertPromotion(p))
+	}
+	return converted
+}
+
+// optionalTime converts a time which is unset when zero
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// LoadPromotion converts a promotion from an admin. It is validated when it is registered.
+func LoadPromotion(input model.PromotionInput) (*store.Promotion, error) {
+	promo := &store.Promotion{
+		Name:     input.Name,
+		SKU:      input.Sku,
+		Category: input.Category,
+		Disabled: input.Enabled != nil && !*input.Enabled,
+	}
+	if input.Code != nil {
+		promo.Code = *input.Code
+	}
+	if input.MaxUses != nil {
+		promo.MaxUses = *input.MaxUses
+	}
+	if input.CodeExpires != nil {
+		promo.CodeExpires = *input.CodeExpires
+	}
+	if input.ValidFrom != nil {
+		promo.ValidFrom = *input.ValidFrom
+	}
+	if input.ValidUntil != nil {
+		promo.ValidUntil = *input.ValidUntil
+	}
+	if input.Priority != nil {
+		promo.Priority = *input.Priority
+	}
+	if input.Group != nil {
+		promo.Group = *input.Group
+	}
+	if input.Stackable != nil {
+		promo.Stackable = *input.Stackable
+	}
+	if input.Schedule != nil {
+		schedule, err := loadSchedule(input.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		promo.Schedule = schedule
+	}
+	if input.Requires != nil {
+		promo.Requires = loadRequirement(input.Requires)
+	}
+	for _, item := range input.Bundle {
+		promo.Bundle = append(promo.Bundle, loadRequirement(item))
+	}
+	tiers, err := loadTiers(input.Tiers)
+	if err != nil {
+		return nil, err
+	}
+	promo.Tiers = tiers
+	if input.Rule != nil {
+		rule, err := loadRule(input.Rule)
+		if err != nil {
+			return nil, err
+		}
+		promo.Rule = rule
+	}
+	return promo, nil
+}
+
+// loadRequirement converts what a cart needs to qualify for a promotion
+func loadRequirement(input *model.RequirementInput) store.Requirement {
+	req := store.Requirement{}
+	if input.Sku != nil {
+		req.SKU = *input.Sku
+	}
+	if input.Count != nil {
+		req.Count = *input.Count
+	}
+	if input.MinSpend != nil {
+		req.MinSpend = *input.MinSpend
+	}
+	return req
+}
+
+// loadRule converts what a promotion gives a qualifying cart
+func loadRule(input *model.RuleInput) (store.RuleDetail, error) {
+	rule := store.RuleDetail{}
+	if input.Sku != nil {
+		rule.SKU = *input.Sku
+	}
+	if input.Count != nil {
+		rule.Count = *input.Count
+	}
+	if input.Discount != nil {
+		discount, err := money.ParseRate(*input.Discount)
+		if err != nil {
+			return rule, err
+		}
+		rule.Discount = discount
+	}
+	if input.Amount != nil {
+		rule.Amount = *input.Amount
+	}
+	if input.Price != nil {
+		rule.Price = *input.Price
+	}
+	if input.MaxRewards != nil {
+		rule.MaxRewards = *input.MaxRewards
+	}
+	return rule, nil
+}
+
+// loadSchedule converts a recurring window with days by name and times as "HH:MM"
+func loadSchedule(input *model.ScheduleInput) (*store.Schedule, error) {
+	schedule := &store.Schedule{}
+	for _, day := range input.Days {
+		weekday, err := store.ParseWeekday(day)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Days = append(schedule.Days, weekday)
+	}
+	if input.From != nil {
+		from, err := store.ParseTimeOfDay(*input.From)
+		if err != nil {
+			return nil, err
+		}
+		schedule.From = from
+	}
+	if input.Until != nil {
+		until, err := store.ParseTimeOfDay(*input.Until)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Until = until
+	}
+	if input.Timezone != nil {
+		schedule.Timezone = *input.Timezone
+	}
+	return schedule, nil
+}
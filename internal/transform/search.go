@@ -0,0 +1,191 @@
+package transform
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jsfan/fake-shop/internal/graph/model"
+	"github.com/jsfan/fake-shop/internal/money"
+	"github.com/jsfan/fake-shop/internal/store"
+	"sort"
+	"strings"
+)
+
+// cursorPrefix marks cursors as pointing at a product
+const cursorPrefix = "product:"
+
+// SearchProducts lists the products customers can buy which match a filter. Variants are listed under their parent.
+// The results are in a stable order, ties being broken by SKU, and are paged through with cursors as in the Relay
+// connection spec.
+func SearchProducts(shop *store.Shop, filter *model.ProductFilter, order *model.ProductSort, first *int, after *string) (*model.ProductConnection, error) {
+	if first != nil && *first < 0 {
+		return nil, fmt.Errorf("invalid page size %d", *first)
+	}
+	inventory := shop.GetInventory()
+	variants := make(map[string][]*store.Product)
+	for _, p := range inventory {
+		if p.Parent != "" && !p.Discontinued {
+			variants[p.Parent] = append(variants[p.Parent], p)
+		}
+	}
+	if err := checkFilterCurrency(filter, inventory); err != nil {
+		return nil, err
+	}
+	listed := make([]*store.Product, 0)
+	for _, p := range inventory {
+		if p.Discontinued || p.Parent != "" {
+			continue
+		}
+		if productMatches(filter, p) || anyMatches(filter, variants[p.SKU]) {
+			listed = append(listed, p)
+		}
+	}
+	less := productOrder(order)
+	sort.Slice(listed, func(i, j int) bool {
+		return less(listed[i], listed[j])
+	})
+
+	start := 0
+	if after != nil {
+		sku, err := decodeCursor(*after)
+		if err != nil {
+			return nil, err
+		}
+		last, ok := inventory[sku]
+		if !ok {
+			return nil, fmt.Errorf(`cursor for SKU "%s" which no longer exists`, sku)
+		}
+		start = sort.Search(len(listed), func(i int) bool {
+			return less(last, listed[i])
+		})
+	}
+	end := len(listed)
+	if first != nil && start+*first < end {
+		end = start + *first
+	}
+
+	connection := &model.ProductConnection{
+		Edges: make([]*model.ProductEdge, 0, end-start),
+		PageInfo: &model.PageInfo{
+			HasNextPage:     end < len(listed),
+			HasPreviousPage: start > 0,
+		},
+		TotalCount: len(listed),
+	}
+	for _, p := range listed[start:end] {
+		connection.Edges = append(connection.Edges, &model.ProductEdge{
+			Cursor: encodeCursor(p.SKU),
+			Node:   convertListing(shop, inventory, p),
+		})
+	}
+	if len(connection.Edges) > 0 {
+		connection.PageInfo.StartCursor = &connection.Edges[0].Cursor
+		connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+	return connection, nil
+}
+
+// encodeCursor creates an opaque cursor pointing at a product
+func encodeCursor(sku string) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + sku))
+}
+
+// decodeCursor finds the SKU of the product a cursor points at
+func decodeCursor(cursor string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), cursorPrefix) {
+		return "", errors.New("invalid cursor")
+	}
+	return strings.TrimPrefix(string(decoded), cursorPrefix), nil
+}
+
+// checkFilterCurrency checks that the prices in a filter are in the shop's currency
+func checkFilterCurrency(filter *model.ProductFilter, inventory map[string]*store.Product) error {
+	if filter == nil {
+		return nil
+	}
+	for _, p := range inventory {
+		for _, limit := range []*money.Money{filter.MinPrice, filter.MaxPrice} {
+			if limit != nil && limit.Currency != p.Price.Currency {
+				return fmt.Errorf("price filter is in %s but the shop uses %s", limit.Currency, p.Price.Currency)
+			}
+		}
+		break // all products are priced in the same currency
+	}
+	return nil
+}
+
+// anyMatches checks if any of a list of products matches a filter
+func anyMatches(filter *model.ProductFilter, products []*store.Product) bool {
+	for _, p := range products {
+		if productMatches(filter, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// productMatches checks if a product meets every condition of a filter
+func productMatches(filter *model.ProductFilter, p *store.Product) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.Search != nil {
+		search := strings.ToLower(strings.TrimSpace(*filter.Search))
+		if !strings.Contains(strings.ToLower(p.Name), search) && !strings.Contains(strings.ToLower(p.SKU), search) {
+			return false
+		}
+	}
+	if filter.MinPrice != nil && p.Price.Cmp(*filter.MinPrice) < 0 {
+		return false
+	}
+	if filter.MaxPrice != nil && p.Price.Cmp(*filter.MaxPrice) > 0 {
+		return false
+	}
+	if filter.Category != nil && !inCategory(p, *filter.Category) {
+		return false
+	}
+	if filter.InStock != nil && (p.Count > 0) != *filter.InStock {
+		return false
+	}
+	return true
+}
+
+// inCategory checks if a product is listed in a category or one of its subcategories
+func inCategory(p *store.Product, category string) bool {
+	category = strings.ToLower(strings.Trim(category, "/ "))
+	for _, c := range p.Categories {
+		c = strings.ToLower(c)
+		if c == category || strings.HasPrefix(c, category+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// productOrder creates the ordering of products for a sort, which is by SKU by default. Ties are broken by SKU.
+func productOrder(order *model.ProductSort) func(a, b *store.Product) bool {
+	field, descending := model.ProductSortFieldSku, false
+	if order != nil {
+		field = order.Field
+		descending = order.Descending != nil && *order.Descending
+	}
+	return func(a, b *store.Product) bool {
+		var cmp int
+		switch field {
+		case model.ProductSortFieldName:
+			cmp = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		case model.ProductSortFieldPrice:
+			cmp = a.Price.Cmp(b.Price)
+		default:
+			cmp = strings.Compare(a.SKU, b.SKU)
+		}
+		if descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return a.SKU < b.SKU
+	}
+}